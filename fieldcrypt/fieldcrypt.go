@@ -0,0 +1,101 @@
+//개인정보 필드를 체인코드 안에서 AES-GCM으로 암호화하기 위한 패키지
+//endorser마다 같은 결과가 나와야 하므로 nonce는 난수가 아니라 키와 nonceSeed로 만든다.
+//nonceSeed에 트랜잭션 ID를 넣어서 같은 키로 같은 nonce를 두 번 쓰지 않게 한다.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+//AES-256 키 길이
+const KeySize = 32
+
+const nonceSize = 12
+
+//키 길이를 확인하는 함수
+func CheckKey(key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("key must be %d bytes", KeySize)
+	}
+	return nil
+}
+
+//키를 구분하기 위한 값 (키 자체는 드러나지 않는다)
+func Fingerprint(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("fieldcrypt key fingerprint"))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+//plaintext를 암호화해서 base64(nonce + 암호문)으로 돌려주는 함수
+//aad는 암호문을 다른 필드나 다른 정보로 옮겨 쓰지 못하게 묶는 값이다.
+func Seal(key []byte, plaintext string, aad string, nonceSeed ...string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	writeParts(mac, append([]string{"fieldcrypt nonce", aad}, nonceSeed...))
+	nonce := mac.Sum(nil)[:nonceSize]
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+//Seal로 만든 값을 복호화하는 함수
+func Open(key []byte, sealed string, aad string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealedAsBytes, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(sealedAsBytes) < nonceSize {
+		return "", fmt.Errorf("ciphertext is malformed")
+	}
+
+	plaintext, err := gcm.Open(nil, sealedAsBytes[:nonceSize], sealedAsBytes[nonceSize:], []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt ciphertext")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	err := CheckKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//값마다 길이를 앞에 붙여서 ("ab","c")와 ("a","bc")가 같아지지 않게 한다.
+func writeParts(mac hash.Hash, parts []string) {
+	var length [8]byte
+	for _, part := range parts {
+		binary.BigEndian.PutUint64(length[:], uint64(len(part)))
+		mac.Write(length[:])
+		mac.Write([]byte(part))
+	}
+}
+
+//검색용 블라인드 인덱스를 만드는 함수
+//같은 키, 필드, 값이면 항상 같은 결과가 나오므로 값을 드러내지 않고 일치 검색에 쓸 수 있다.
+func BlindIndex(key []byte, field string, value string) string {
+	mac := hmac.New(sha256.New, key)
+	writeParts(mac, []string{"fieldcrypt blind index", field, value})
+	return hex.EncodeToString(mac.Sum(nil))
+}
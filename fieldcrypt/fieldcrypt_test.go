@@ -0,0 +1,180 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x11}, KeySize)
+var otherKey = bytes.Repeat([]byte{0x22}, KeySize)
+
+func TestCheckKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key []byte
+		wantErr bool
+	}{
+		{"32바이트", testKey, false},
+		{"nil", nil, true},
+		{"16바이트", make([]byte, 16), true},
+		{"33바이트", make([]byte, 33), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		plaintext string
+		aad string
+		nonceSeed []string
+	}{
+		{"빈 값", "", "name", []string{"tx1"}},
+		{"영문", "tndyd5390", "id", []string{"tx1"}},
+		{"한글", "김수용", "name", []string{"tx1", "identifier1"}},
+		{"nonceSeed 없음", "+821057907883", "phone", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := Seal(testKey, tt.plaintext, tt.aad, tt.nonceSeed...)
+			if err != nil {
+				t.Fatalf("Seal() error = %v", err)
+			}
+			if tt.plaintext != "" && bytes.Contains([]byte(sealed), []byte(tt.plaintext)) {
+				t.Fatalf("Seal() output contains plaintext: %s", sealed)
+			}
+			opened, err := Open(testKey, sealed, tt.aad)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if opened != tt.plaintext {
+				t.Fatalf("Open() = %q, want %q", opened, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	sealed, err := Seal(testKey, "김수용", "name", "tx1")
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	sealedAsBytes, _ := base64.StdEncoding.DecodeString(sealed)
+
+	flip := func(index int) string {
+		tampered := append([]byte(nil), sealedAsBytes...)
+		tampered[index] ^= 0x01
+		return base64.StdEncoding.EncodeToString(tampered)
+	}
+
+	tests := []struct {
+		name string
+		key []byte
+		sealed string
+		aad string
+	}{
+		{"다른 키", otherKey, sealed, "name"},
+		{"잘못된 키 길이", testKey[:16], sealed, "name"},
+		{"다른 aad", testKey, sealed, "phone"},
+		{"nonce 변조", testKey, flip(0), "name"},
+		{"암호문 변조", testKey, flip(nonceSize), "name"},
+		{"태그 변조", testKey, flip(len(sealedAsBytes) - 1), "name"},
+		{"잘라낸 값", testKey, base64.StdEncoding.EncodeToString(sealedAsBytes[:nonceSize-1]), "name"},
+		{"base64 아님", testKey, "not base64!", "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := Open(tt.key, tt.sealed, tt.aad)
+			if err == nil {
+				t.Fatalf("Open() = %q, want error", opened)
+			}
+		})
+	}
+}
+
+func TestSealNonce(t *testing.T) {
+	seal := func(key []byte, plaintext string, aad string, nonceSeed ...string) string {
+		sealed, err := Seal(key, plaintext, aad, nonceSeed...)
+		if err != nil {
+			t.Fatalf("Seal() error = %v", err)
+		}
+		return sealed
+	}
+
+	//endorser마다 같은 결과가 나와야 한다.
+	if seal(testKey, "김수용", "name", "tx1") != seal(testKey, "김수용", "name", "tx1") {
+		t.Fatalf("Seal() is not deterministic for the same inputs")
+	}
+
+	tests := []struct {
+		name string
+		a []string
+		b []string
+	}{
+		{"트랜잭션이 다르면", []string{"tx1"}, []string{"tx2"}},
+		{"seed 경계가 다르면", []string{"ab", "c"}, []string{"a", "bc"}},
+		{"seed 개수가 다르면", []string{"tx1"}, []string{"tx1", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := base64.StdEncoding.DecodeString(seal(testKey, "김수용", "name", tt.a...))
+			b, _ := base64.StdEncoding.DecodeString(seal(testKey, "김수용", "name", tt.b...))
+			if bytes.Equal(a[:nonceSize], b[:nonceSize]) {
+				t.Fatalf("nonce is reused for seeds %q and %q", tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint(testKey) != Fingerprint(testKey) {
+		t.Fatalf("Fingerprint() is not deterministic")
+	}
+	if Fingerprint(testKey) == Fingerprint(otherKey) {
+		t.Fatalf("Fingerprint() is the same for different keys")
+	}
+	if len(Fingerprint(testKey)) != 16 {
+		t.Fatalf("Fingerprint() length = %d, want 16", len(Fingerprint(testKey)))
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	base := BlindIndex(testKey, "name", "김수용")
+	if len(base) != 64 {
+		t.Fatalf("BlindIndex() length = %d, want 64", len(base))
+	}
+
+	tests := []struct {
+		name string
+		key []byte
+		field string
+		value string
+		same bool
+	}{
+		{"같은 키, 필드, 값", testKey, "name", "김수용", true},
+		{"다른 키", otherKey, "name", "김수용", false},
+		{"다른 필드", testKey, "id", "김수용", false},
+		{"다른 값", testKey, "name", "김수영", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BlindIndex(tt.key, tt.field, tt.value)
+			if (got == base) != tt.same {
+				t.Fatalf("BlindIndex() = %s, base %s, want same = %v", got, base, tt.same)
+			}
+		})
+	}
+
+	//필드와 값의 경계가 섞이지 않아야 한다.
+	if BlindIndex(testKey, "ab", "c") == BlindIndex(testKey, "a", "bc") {
+		t.Fatalf("BlindIndex() collides across field/value boundary")
+	}
+}
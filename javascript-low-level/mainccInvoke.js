@@ -32,7 +32,16 @@ const checkMainInfoNvl = (mainInfoObj) => {
 
 
 
-const createMainInfo = async(user, mainInfoObj) => {
+//채널 솔트를 처음 한 번 등록한다. (관리자만, 이후 다른 솔트로 만든 요청은 거절된다)
+//identifierSalt: 식별자를 만들 때 쓰는 채널 비밀 솔트 (16바이트 이상의 임의 값 Buffer)
+const setIdentifierSalt = async(user, identifierSalt) => {
+	if (!identifierSalt) return false;
+	var result = await invoke(CHAINCODE_ID, "setIdentifierSalt", CHANNEL_NAME, user, [], { identifierSalt });
+	return result;
+}
+
+//identifierSalt: 식별자를 만들 때 쓰는 채널 비밀 솔트 (setIdentifierSalt로 등록한 값)
+const createMainInfo = async(user, mainInfoObj, identifierSalt) => {
 	if (
 		strIsEmpty(mainInfoObj.name) ||
 		strIsEmpty(mainInfoObj.phone) ||
@@ -49,12 +58,14 @@ const createMainInfo = async(user, mainInfoObj) => {
 			mainInfoObj.name, 
 			mainInfoObj.phone, 
 			mainInfoObj.id
-		]
+		],
+		{ identifierSalt }
 	);
 	return result;
 
 }
 
+//mainInfoObj.version: 수정하기 전에 읽은 버전 (그 사이 다른 사람이 수정했으면 "Version conflict" 에러)
 const modificateMainInfo = async(user, mainInfoObj) => {
 	mainInfoObj = checkMainInfoNvl(mainInfoObj);
 	var result = await invoke(
@@ -66,7 +77,8 @@ const modificateMainInfo = async(user, mainInfoObj) => {
 			mainInfoObj.identifier,
 			mainInfoObj.name, 
 			mainInfoObj.phone, 
-			mainInfoObj.id
+			mainInfoObj.id,
+			String(nvl(mainInfoObj.version) || 0)
 		]
 	)
 	return result;
@@ -78,7 +90,92 @@ const deleteMainInfo = async(user, identifier) => {
 	return result;
 }
 
-const invoke = async(chaincodeId, fcn, channelId, user, args = []) => {
+//예전 방식(v1) 식별자의 정보를 새 식별자로 옮긴다. 예전 식별자에는 새 식별자가 남는다.
+const migrateMainInfoIdentifier = async(user, identifier, identifierSalt) => {
+	var result = await invoke(CHAINCODE_ID, "migrateMainInfoIdentifier", CHANNEL_NAME, user, [nvl(identifier)], { identifierSalt });
+	return result;
+}
+
+//patch: {name, phone, id, salt} 중 바꿀 필드만 넣는다. (null은 지우기라서 필수 필드면 검사 에러가 난다)
+//version: 수정하기 전에 읽은 버전, key: 정보를 암호화하는 32바이트 Buffer (필수)
+const patchMainInfo = async(user, identifier, version, patch, key) => {
+	if (strIsEmpty(identifier) || !patch || !key) return false;
+	var transientMap = { mainInfoPatch: Buffer.from(JSON.stringify(patch)), mainInfoKey: key };
+	var result = await invoke(
+		CHAINCODE_ID,
+		"patchMainInfo",
+		CHANNEL_NAME,
+		user,
+		[identifier, String(nvl(version) || 0)],
+		transientMap
+	);
+	return result;
+}
+
+//열람 기록을 남기고 트랜잭션 ID를 돌려준다. 정보는 mainccQuery.js의 getMainInfoByAccessGrant로 읽는다.
+const getMainInfoAudited = async(user, identifier, purpose) => {
+	if (strIsEmpty(identifier) || strIsEmpty(purpose)) return false;
+	var result = await invoke(CHAINCODE_ID, "getMainInfoAudited", CHANNEL_NAME, user, [identifier, purpose]);
+	return result;
+}
+
+//field: name, phone, id. 찾을 값은 블록에 남지 않도록 transient로 보낸다.
+const queryMainInfoAudited = async(user, field, value, purpose) => {
+	if (strIsEmpty(field) || strIsEmpty(value) || strIsEmpty(purpose)) return false;
+	var result = await invoke(
+		CHAINCODE_ID,
+		"queryMainInfoAudited",
+		CHANNEL_NAME,
+		user,
+		[field, purpose],
+		{ mainInfoQuery: Buffer.from(value) }
+	);
+	return result;
+}
+
+//이름, 연락처, 아이디로 찾고 열람 기록을 남긴다. 찾을 값은 블록에 남지 않도록 transient로 보낸다.
+const queryMainInfoByName = async(user, name, purpose) => {
+	if (strIsEmpty(name) || strIsEmpty(purpose)) return false;
+	var result = await invoke(CHAINCODE_ID, "queryMainInfoByName", CHANNEL_NAME, user, [purpose], { mainInfoQuery: Buffer.from(name) });
+	return result;
+}
+
+const queryMainInfoByPhone = async(user, phone, purpose) => {
+	if (strIsEmpty(phone) || strIsEmpty(purpose)) return false;
+	var result = await invoke(CHAINCODE_ID, "queryMainInfoByPhone", CHANNEL_NAME, user, [purpose], { mainInfoQuery: Buffer.from(phone) });
+	return result;
+}
+
+const queryMainInfoById = async(user, id, purpose) => {
+	if (strIsEmpty(id) || strIsEmpty(purpose)) return false;
+	var result = await invoke(CHAINCODE_ID, "queryMainInfoById", CHANNEL_NAME, user, [purpose], { mainInfoQuery: Buffer.from(id) });
+	return result;
+}
+
+//queryString: {"selector":{...}} 형식의 쿼리
+const queryMainInfoByQueryString = async(user, queryString, purpose) => {
+	if (strIsEmpty(queryString) || strIsEmpty(purpose)) return false;
+	var result = await invoke(CHAINCODE_ID, "queryMainInfoByQueryString", CHANNEL_NAME, user, [purpose], { mainInfoQuery: Buffer.from(queryString) });
+	return result;
+}
+
+//한 페이지만 열람 기록을 남기고 {grant, bookmark, fetchedCount}를 돌려준다. grant.txId로 정보를 읽고 bookmark로 다음 페이지를 찾는다.
+const queryMainInfoPage = async(user, queryString, purpose, pageSize, bookmark = "") => {
+	if (strIsEmpty(queryString) || strIsEmpty(purpose)) return false;
+	var result = await invoke(
+		CHAINCODE_ID,
+		"queryMainInfoPage",
+		CHANNEL_NAME,
+		user,
+		[String(pageSize), bookmark, purpose],
+		{ mainInfoQuery: Buffer.from(queryString) },
+		true
+	);
+	return result;
+}
+
+//returnPayload가 true면 트랜잭션 ID 대신 commit된 트랜잭션의 결과를 돌려준다.
+const invoke = async(chaincodeId, fcn, channelId, user, args = [], transientMap, returnPayload = false) => {
 	var result = false;
 	console.log('\n\n --- invoke.js - start');
 	try {
@@ -106,6 +203,7 @@ const invoke = async(chaincodeId, fcn, channelId, user, args = []) => {
 			chaincodeId,
 			fcn,
 			args,
+			transientMap,
 			chainId: channelId,
 			txId: tx_id
 		};
@@ -180,8 +278,8 @@ const invoke = async(chaincodeId, fcn, channelId, user, args = []) => {
 		if (results[1] instanceof Error) {
 			throw new Error(message);
 		} else if (results[1].event_status === 'VALID') {
-			//최종 결과값
-			result = true;
+			//최종 결과값 (트랜잭션 ID, getMainInfoAudited 결과를 읽을 때 쓴다)
+			result = returnPayload ? proposalResponses[0].response.payload.toString() : transaction_id_string;
 		} else {
 			const message = util.format('Transaction failed to be committed to the ledger due to : %s', results[1].event_status)
 			throw new Error(message);
@@ -196,5 +294,15 @@ const invoke = async(chaincodeId, fcn, channelId, user, args = []) => {
 module.exports = {
 	createMainInfo,
 	modificateMainInfo,
-	deleteMainInfo
+	deleteMainInfo,
+	migrateMainInfoIdentifier,
+	setIdentifierSalt,
+	patchMainInfo,
+	getMainInfoAudited,
+	queryMainInfoAudited,
+	queryMainInfoByName,
+	queryMainInfoByPhone,
+	queryMainInfoById,
+	queryMainInfoByQueryString,
+	queryMainInfoPage
 }
\ No newline at end of file
@@ -22,37 +22,103 @@ const getAllMainInfo = async(user) => {
 	return result;
 }
 
-const getMainInfoByIdentifier = async(user, identifier) => {
-	var result = await query(CHAINCODE_ID, "getMainInfoByIdentifier", user, [identifier]);
+//정보 주체 본인만 호출할 수 있다. 그 외에는 mainccInvoke.js의 getMainInfoAudited 뒤에 getMainInfoByAccessGrant로 읽는다.
+//purpose: 정보 주체가 동의한 이용 목적 (동의한 정보만 돌려준다)
+//key: 암호화해서 저장한 정보를 복호화할 32바이트 Buffer (없으면 암호문 그대로)
+const getMainInfoByIdentifier = async(user, identifier, purpose, key) => {
+	var result = await query(CHAINCODE_ID, "getMainInfoByIdentifier", user, [identifier, purpose], mainInfoKeyTransient(key));
 	return result;
 }
 
-const queryMainInfoByName = async(user, name) => {
-	var result = await query(CHAINCODE_ID, "queryMainInfoByName", user, [name]);
+//txId: getMainInfoAudited, queryMainInfoAudited, queryMainInfoBy*, queryMainInfoPage 트랜잭션 ID (commit된 뒤 같은 사용자만 읽는다. 기한은 없고, 새로 열람할 때는 audited 함수를 다시 호출한다)
+//key: 암호화해서 저장한 정보를 복호화할 32바이트 Buffer (없으면 암호문 그대로)
+const getMainInfoByAccessGrant = async(user, txId, key) => {
+	var result = await query(CHAINCODE_ID, "getMainInfoByAccessGrant", user, [txId], mainInfoKeyTransient(key));
 	return result;
 }
 
-const queryMainInfoByPhone = async(user, phone) => {
-	var result = await query(CHAINCODE_ID, "queryMainInfoByPhone", user, [phone]);
+const getAllMainInfoPage = async(user, pageSize, bookmark = "") => {
+	var result = await query(CHAINCODE_ID, "getAllMainInfoPage", user, [String(pageSize), bookmark]);
 	return result;
 }
 
-const queryMainInfoById = async(user, id) => {
-	var result = await query(CHAINCODE_ID, "queryMainInfoById", user, [id]);
+//페이지를 끝까지 넘기면서 onPage(records)를 호출한다.
+//fetchPage는 bookmark를 받아 getAllMainInfoPage 결과를 돌려주는 함수
+const walkMainInfoPages = async(pageSize, fetchPage, onPage) => {
+	var bookmark = "";
+	while (true) {
+		var result = await fetchPage(bookmark);
+		if (result == null) return false;
+		var page = JSON.parse(result);
+		if (page.records.length > 0) await onPage(page.records);
+		if (page.fetchedCount < pageSize || page.bookmark == bookmark) return true;
+		bookmark = page.bookmark;
+	}
+}
+
+//from, to: RFC3339 시각, maxEntries: 최대 개수 (안 쓰면 빈 값)
+const getHistoryMainInfo = async(user, identifier, from = "", to = "", maxEntries = "") => {
+	var result = await query(CHAINCODE_ID, "getHistoryMainInfo", user, [identifier, from, to, String(maxEntries)]);
+	return result;
+}
+
+//정보 주체 본인만 호출할 수 있다. (role=subject, identifier 속성이 identifier와 같아야 한다)
+//timestamp: RFC3339 시각
+const getMainInfoAsOf = async(user, identifier, timestamp, purpose) => {
+	var result = await query(CHAINCODE_ID, "getMainInfoAsOf", user, [identifier, timestamp, purpose]);
+	return result;
+}
+
+//정보 주체 본인만 호출할 수 있다.
+const diffMainInfo = async(user, identifier, t1, t2, purpose) => {
+	var result = await query(CHAINCODE_ID, "diffMainInfo", user, [identifier, t1, t2, purpose]);
+	return result;
+}
+
+const getConsentsForMainInfo = async(user, identifier) => {
+	var result = await query(CHAINCODE_ID, "getConsentsForMainInfo", user, [identifier]);
+	return result;
+}
+
+//정보 주체가 요청한 열람 자료 (현재 정보, 이력, 사본, 동의, 열람 기록을 formatVersion이 붙은 json 하나로 돌려준다)
+//정보 주체 본인만 호출할 수 있다.
+//key: 암호화해서 저장한 정보를 복호화할 32바이트 Buffer (없으면 암호문 그대로)
+const exportMyData = async(user, identifier, key) => {
+	var result = await query(CHAINCODE_ID, "exportMyData", user, [identifier], mainInfoKeyTransient(key));
 	return result;
 }
 
-const queryMainInfoByQueryString = async(user, queryString) => {
-	var result = await query(CHAINCODE_ID, "queryMainInfoByQueryString", user, [queryString]);
+//asOf: RFC3339 시각 (빈 값이면 지금), 보유 기한이 지난 정보를 페이지 단위로 가져온다.
+const queryExpiredMainInfo = async(user, asOf, pageSize, bookmark = "") => {
+	var result = await query(CHAINCODE_ID, "queryExpiredMainInfo", user, [asOf, String(pageSize), bookmark]);
 	return result;
 }
 
-const getHistoryMainInfo = async(user, identifier) => {
-	var result = await query(CHAINCODE_ID, "getHistoryMainInfo", user, [identifier]);
+//입력을 미리 검사할 때 쓰는 규칙 (nameMinLength, nameMaxLength, namePattern, idPattern, mobilePrefixes)
+const getValidationRules = async(user) => {
+	var result = await query(CHAINCODE_ID, "getValidationRules", user, []);
 	return result;
 }
 
-const query = async(chaincodeId, fcn, user, args = []) => {
+//검사에 실패한 에러 메시지에서 필드별 오류를 꺼낸다. ([{field, message}], 검사 오류가 아니면 null)
+const parseValidationError = (message) => {
+	message = String(message);
+	var start = message.indexOf('{"Error":"validation failed"');
+	if (start < 0) return null;
+	try {
+		//fabric이 앞뒤에 붙이는 문구는 빼고 json 부분만 읽는다.
+		return JSON.parse(message.substring(start, message.lastIndexOf("}") + 1)).fields;
+	} catch (error) {
+		return null;
+	}
+}
+
+const mainInfoKeyTransient = (key) => {
+	if (!key) return undefined;
+	return { mainInfoKey: key };
+}
+
+const query = async(chaincodeId, fcn, user, args = [], transientMap) => {
 	var result = null;
 	try{
 		var state_store = await Fabric_Client.newDefaultKeyValueStore({path: store_path});
@@ -69,7 +135,8 @@ const query = async(chaincodeId, fcn, user, args = []) => {
 			//targets : --- letting this default to the peers assigned to the channel
 			chaincodeId,
 			fcn,
-			args
+			args,
+			transientMap
 		};
 		var query_responses = await channel.queryByChaincode(request);
 		console.log("Query has completed, checking results");
@@ -107,9 +174,15 @@ const getBlockByNumber = async(user, blockNumber) => {
 module.exports = {
 	getAllMainInfo,
 	getMainInfoByIdentifier,
-	queryMainInfoByName,
-	queryMainInfoById,
-	queryMainInfoByPhone,
-	queryMainInfoByQueryString,
-	getHistoryMainInfo
+	getMainInfoByAccessGrant,
+	getAllMainInfoPage,
+	walkMainInfoPages,
+	getHistoryMainInfo,
+	getMainInfoAsOf,
+	diffMainInfo,
+	getConsentsForMainInfo,
+	queryExpiredMainInfo,
+	exportMyData,
+	getValidationRules,
+	parseValidationError
 }
\ No newline at end of file
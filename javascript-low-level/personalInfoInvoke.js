@@ -24,7 +24,6 @@ const checkPersonalInfoNvl = personalInfoObj => {
     personalInfoObj.registrationNumber = nvl(personalInfoObj.registrationNumber);
     personalInfoObj.address = nvl(personalInfoObj.address);
     personalInfoObj.email = nvl(personalInfoObj.email);
-    personalInfoObj.password = nvl(personalInfoObj.password);
     personalInfoObj.logs = nvl(personalInfoObj.logs);
     return personalInfoObj;
 }
@@ -34,8 +33,7 @@ const createPersonalInfo = async (user, personalInfoObj) => {
     if (
         strIsEmpty(personalInfoObj.registrationNumber) ||
         strIsEmpty(personalInfoObj.address) ||
-        strIsEmpty(personalInfoObj.email) ||
-        strIsEmpty(personalInfoObj.password)
+        strIsEmpty(personalInfoObj.email)
     ){
         return false;
     }
@@ -50,7 +48,6 @@ const createPersonalInfo = async (user, personalInfoObj) => {
             personalInfoObj.registrationNumber,
             personalInfoObj.address,
             personalInfoObj.email,
-            personalInfoObj.password,
             personalInfoObj.logs
         ]
     );
@@ -69,7 +66,6 @@ const modificatePersonalInfo = async(user, personalInfoObj) => {
             personalInfoObj.registrationNumber,
             personalInfoObj.address,
             personalInfoObj.email,
-            personalInfoObj.password,
             personalInfoObj.logs
         ]
     );
@@ -12,12 +12,15 @@ const {
 const CHAINCODE_ID = "test1";
 const CHANNEL_NAME = "mychannel";
 const PEER_IP = "grpc://localhost:7051";
+const ORDERER_IP = "grpc://localhost:7050";
 //==========================================
 
 var fabric_client = new Fabric_Client();
 var channel = fabric_client.newChannel(CHANNEL_NAME);
 var peer = fabric_client.newPeer(PEER_IP);
 channel.addPeer(peer);
+var orderer = fabric_client.newOrderer(ORDERER_IP);
+channel.addOrderer(orderer);
 var member_user = null;
 var store_path = path.join(__dirname, 'hfc-key-store');
 
@@ -26,16 +29,17 @@ const checkPersonalInfoNvl = personalInfoObj => {
     personalInfoObj.registrationNumber = nvl(personalInfoObj.registrationNumber);
     personalInfoObj.address = nvl(personalInfoObj.address);
     personalInfoObj.email = nvl(personalInfoObj.email);
-    personalInfoObj.password = nvl(personalInfoObj.password);
     personalInfoObj.logs = nvl(personalInfoObj.logs);
     return personalInfoObj;
 }
 
-const getAllPersonalInfo = async(user) => {
+const getAllPersonalInfo = async(user, logs) => {
+	if(strIsEmpty(logs)) return false;
     var result = await query(
 		CHAINCODE_ID,
 		"getAllPersonalInfo",
-		user
+		user,
+		[logs]
 	);
     return result;
 }
@@ -62,68 +66,94 @@ const getPersonalInfoByIdentifier = async(user, personalInfoObj) => {
 
 const queryPersonalInfoByRegistrationNumber = async(user, personalInfoObj) => {
 	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
-	if (strIsEmpty(personalInfoObj.registrationNumber)) return false;
+	if(
+		strIsEmpty(personalInfoObj.registrationNumber) ||
+		strIsEmpty(personalInfoObj.logs)
+	) return false;
 	var result = await query(
 		CHAINCODE_ID,
 		"queryPersonalInfoByRegistrationNumber",
 		user,
-		[personalInfoObj.registrationNumber]
+		[
+			personalInfoObj.registrationNumber,
+			personalInfoObj.logs,
+		]
 	);
 	return result;
 }
 
 const queryPersonalInfoByAddress = async(user, personalInfoObj) => {
 	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
-	if(strIsEmpty(personalInfoObj.address)) return false;
+	if(
+		strIsEmpty(personalInfoObj.address) ||
+		strIsEmpty(personalInfoObj.logs)
+	) return false;
 	var result = await query(
 		CHAINCODE_ID,
 		"queryPersonalInfoByAddress",
 		user,
-		[personalInfoObj.address]
+		[
+			personalInfoObj.address,
+			personalInfoObj.logs,
+		]
 	);
 	return result;
 }
 
 const queryPersonalInfoByEmail = async(user, personalInfoObj) => {
 	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
-	if(strIsEmpty(personalInfoObj.email)) return false;
+	if(
+		strIsEmpty(personalInfoObj.email) ||
+		strIsEmpty(personalInfoObj.logs)
+	) return false;
 	var result = await query(
 		CHAINCODE_ID,
 		"queryPersonalInfoByEmail",
 		user,
-		[personalInfoObj.email]
+		[
+			personalInfoObj.email,
+			personalInfoObj.logs,
+		]
 	);
 	return result;
 }
 
-const queryPersonalInfoByPassword = async(user, personalInfoObj) => {
-	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
-	if(strIsEmpty(personalInfoObj.password)) return false;
+const queryPersonalInfoByQueryString = async(user, queryString, logs) => {
+	if(strIsEmpty(logs)) return false;
 	var result = await query(
 		CHAINCODE_ID,
-		"queryPersonalInfoByPassword",
+		"queryPersonalInfoByQueryString",
 		user,
-		[personalInfoObj.password]
+		[queryString, logs]
 	);
 	return result;
 }
 
-const queryPersonalInfoByQueryString = async(user, queryString) => {
+const getHistoryPersonalInfo = async(user, personalInfoObj) => {
+	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
+	if(
+		strIsEmpty(personalInfoObj.identifier) ||
+		strIsEmpty(personalInfoObj.logs)
+	) return false;
 	var result = await query(
 		CHAINCODE_ID,
-		"queryPersonalInfoByQueryString",
+		"getHistoryPersonalInfo",
 		user,
-		[queryString]
+		[
+			personalInfoObj.identifier,
+			personalInfoObj.logs,
+		]
 	);
 	return result;
 }
 
-const getHistoryPersonalInfo = async(user, personalInfoObj) => {
+//열람 기록 가져오기 (관리자만)
+const getAccessLogForPersonalInfo = async(user, personalInfoObj) => {
 	personalInfoObj = checkPersonalInfoNvl(personalInfoObj);
 	if(strIsEmpty(personalInfoObj.identifier)) return false;
 	var result = await query(
 		CHAINCODE_ID,
-		"getHistoryPersonalInfo",
+		"getAccessLogForPersonalInfo",
 		user,
 		[personalInfoObj.identifier]
 	);
@@ -141,6 +171,7 @@ const main = async() => {
     console.log(result);
 }
 
+//열람 기록이 원장에 남도록 조회도 트랜잭션으로 보내고, 커밋된 뒤 보증받은 결과를 돌려준다.
 const query = async(chaincodeId, fcn, user, args = []) => {
 	var result = null;
 	try{
@@ -154,23 +185,55 @@ const query = async(chaincodeId, fcn, user, args = []) => {
 		if(!(user_from_store && user_from_store.isEnrolled())){
 			throw new Error(`Failed to get ${user} from user store`);
 		}
+		var tx_id = fabric_client.newTransactionID();
 		const request = {
-			//targets : --- letting this default to the peers assigned to the channel
+			targets: [peer],
 			chaincodeId,
 			fcn,
-			args
+			args,
+			chainId: CHANNEL_NAME,
+			txId: tx_id
 		};
-		var query_responses = await channel.queryByChaincode(request);
-		console.log("Query has completed, checking results");
-		if (query_responses && query_responses.length == 1) {
-			if (query_responses[0] instanceof Error) {
-				throw new Error(`error from query = ${query_responses[0]}`);
-			} else {
-				result = query_responses[0].toString();
-			}
-		} else {
-			throw new Error("No payloads were returned from query");
+		var endorsement_results = await channel.sendTransactionProposal(request);
+		var proposalResponses = endorsement_results[0];
+		var proposal = endorsement_results[1];
+		if (proposalResponses[0] instanceof Error) {
+			throw new Error(`error from query = ${proposalResponses[0]}`);
+		} else if (!(proposalResponses[0].response && proposalResponses[0].response.status === 200)) {
+			throw new Error(util.format('Query proposal:: %j', proposalResponses[0]));
+		}
+		var payload = proposalResponses[0].response.payload.toString();
+
+		var transaction_id_string = tx_id.getTransactionID();
+		var event_hub = channel.newChannelEventHub(peer);
+		var txPromise = new Promise((resolve) => {
+			let handle = setTimeout(() => {
+				event_hub.unregisterTxEvent(transaction_id_string);
+				event_hub.disconnect();
+				resolve({event_status : 'TIMEOUT'});
+			}, 30000);
+			event_hub.registerTxEvent(transaction_id_string, (tx, code) => {
+				clearTimeout(handle);
+				resolve({event_status : code});
+			}, (err) => {
+				clearTimeout(handle);
+				resolve({event_status : err.toString()});
+			}, {disconnect: true});
+			event_hub.connect();
+		});
+		var results = await Promise.all([
+			channel.sendTransaction({ orderer, proposalResponses, proposal }),
+			txPromise
+		]);
+		if (results[0].status !== 'SUCCESS') {
+			throw new Error(`Failed to order the transaction. Error code: ${results[0].status}`);
+		}
+		//열람 기록이 커밋되지 않았으면 결과도 돌려주지 않는다.
+		if (results[1].event_status !== 'VALID') {
+			throw new Error(`Transaction failed to be committed to the ledger due to : ${results[1].event_status}`);
 		}
+		console.log("Query has been committed, returning results");
+		result = payload;
 	} catch (error) {
 		console.error(`Failed to submit transaction: ${error}`);
 		return null;
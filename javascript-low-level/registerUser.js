@@ -13,7 +13,9 @@ var AFFILIATION = "org1.department1";
 const CA_IP = "http://localhost:7054";
 const MSP_ID = "Org1MSP";
 
-const registerUser = async(user, affiliation = AFFILIATION) => {
+//role: admin | registrar | auditor | subject (체인코드 역할표에서 사용)
+//subject인 경우 identifier에 본인 정보의 식별자를 넣는다.
+const registerUser = async(user, role, identifier, affiliation = AFFILIATION) => {
     try{
         var state_store = await Fabric_Client.newDefaultKeyValueStore({path: store_path});
         fabric_client.setStateStore(state_store);
@@ -32,7 +34,11 @@ const registerUser = async(user, affiliation = AFFILIATION) => {
         }else {
             throw new Error("Failed to get admin...");
         }
-        var secret = await fabric_ca_client.register({enrollmentID: user, affiliation: affiliation, role: 'client'}, admin_user);
+        var attrs = [{name: 'role', value: role, ecert: true}];
+        if (identifier) {
+            attrs.push({name: 'identifier', value: identifier, ecert: true});
+        }
+        var secret = await fabric_ca_client.register({enrollmentID: user, affiliation: affiliation, role: 'client', attrs: attrs}, admin_user);
         var enrollment = await fabric_ca_client.enroll({enrollmentID: user, enrollmentSecret: secret});
         var enrolledUser = await fabric_client.createUser({
             username: user,
@@ -45,4 +51,4 @@ const registerUser = async(user, affiliation = AFFILIATION) => {
         console.log(err);
     }
 }
-registerUser("user1");
\ No newline at end of file
+registerUser("user1", "registrar");
\ No newline at end of file
@@ -1,13 +1,16 @@
 package main
 
-import {
+import (
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
+	"github.com/fabcar/go/selector"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
-}
+)
 
 type SmartContract struct {
 }
@@ -19,28 +22,67 @@ type BasicInfo struct {
 	Id string `json:"id"`
 }
 
+//queryBasicInfoByKeyValue로 검색할 수 있는 필드
+var basicInfoSchema = selector.NewSchema("identifier", "name", "phone", "id")
+
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response{
 	return shim.Success(nil)
 }
 
 func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
-	
+
 	function, args := APIstub.GetFunctionAndParameters()
 
 	if function == "createBasicInfo"{
+		//기본정보 생성
 		return s.CreateBasicInfo(APIstub, args)
 	} else if function == "queryAllBasicInfo" {
+		//원장의 모든 정보 가져오기
 		return s.QueryAllBasicInfo(APIstub)
+	} else if function == "getBasicInfoByKey" {
+		//키로 정보 가져오기
+		return s.GetBasicInfoByKey(APIstub, args)
 	} else if function == "queryBasicInfoByKeyValue" {
+		//필드와 값으로 정보 가져오기
 		return s.QueryBasicInfoByKeyValue(APIstub, args)
+	} else if function == "updateBasicInfo" {
+		//정보 수정하기
+		return s.UpdateBasicInfo(APIstub, args)
+	} else if function == "deleteBasicInfo" {
+		//정보 삭제하기
+		return s.DeleteBasicInfo(APIstub, args)
+	} else if function == "getHistoryBasicInfo" {
+		//정보 이력 가져오기
+		return s.GetHistoryBasicInfo(APIstub, args)
 	}
+
+	return shim.Error("Invalid Smart Contract function name. ")
 }
 
+//기본정보 생성 함수
+// args: 키, 식별자, 이름, 연락처, 아이디
 func (s *SmartContract) CreateBasicInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	if len(args) != 5 {
 		return shim.Error("Incorrect number of arguments.Expecting 5")
 	}
-	
+
+	//같은 키로 등록되어 있는것이 있는지 확인한다.
+	valAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if valAsBytes != nil {
+		return shim.Error("{\"Error\":\"Already exists: " + args[0] + "\"}")
+	}
+
+	//같은 식별자로 등록되어 있는것이 있는지 확인한다.
+	queryResults, err := getQueryResultForKeyValue(APIstub, "identifier", args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if string(queryResults) != "[]" {
+		return shim.Error("{\"Error\":\"identifier already exists: " + args[1] + "\"}")
+	}
+
 	var basicInfo = BasicInfo{Identifier: args[1], Name: args[2], Phone: args[3], Id: args[4]}
 
 	basicInfoAsBytes, _ := json.Marshal(basicInfo)
@@ -60,27 +102,155 @@ func (s *SmartContract) QueryAllBasicInfo(APIstub shim.ChaincodeStubInterface) s
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.buffer
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(buffer.Bytes())
+}
+
+//키로 정보 가져오는 함수
+func (s *SmartContract) GetBasicInfoByKey(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	basicInfoAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if basicInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"key does not exist: " + args[0] + "\"}")
+	}
+
+	return shim.Success(basicInfoAsBytes)
+}
+
+//필드와 값으로 정보 가져오는 함수 (basicInfoSchema에 있는 필드만 검색할 수 있다)
+func (s *SmartContract) QueryBasicInfoByKeyValue(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	key := strings.ToLower(args[0])
+	value := args[1]
+
+	queryResults, err := getQueryResultForKeyValue(APIstub, key, value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(queryResults)
+}
+
+//정보 수정을 위한 함수 (빈 값은 수정하지 않는다)
+// args: 키, 이름, 연락처, 아이디
+func (s *SmartContract) UpdateBasicInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	basicInfoAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if basicInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"key does not exist: " + args[0] + "\"}")
+	}
+
+	basicInfo := BasicInfo{}
+	err = json.Unmarshal(basicInfoAsBytes, &basicInfo)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to decode JSON of: " + args[0] + "\"}")
+	}
+
+	if args[1] != "" {
+		basicInfo.Name = args[1]
+	}
+
+	if args[2] != "" {
+		basicInfo.Phone = args[2]
+	}
+
+	if args[3] != "" {
+		basicInfo.Id = args[3]
+	}
+
+	basicInfoAsBytes, _ = json.Marshal(basicInfo)
+	APIstub.PutState(args[0], basicInfoAsBytes)
+
+	return shim.Success(nil)
+}
+
+//정보를 삭제하는 함수
+func (s *SmartContract) DeleteBasicInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	key := args[0]
+
+	valAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + key + "\"}")
+	} else if valAsBytes == nil {
+		return shim.Error("{\"Error\":\"key does not exist: " + key + "\"}")
+	}
+
+	err = APIstub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete state : " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//키에 해당하는 정보의 이력 가져오기
+func (s *SmartContract) GetHistoryBasicInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	resultsIterator, err := APIstub.GetHistoryForKey(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
 	buffer.WriteString("[")
 
 	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+		response, err := resultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
 		}
+		buffer.WriteString("{\"TxId\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(response.TxId)
+		buffer.WriteString("\"")
 
-		buffer.WriteString("{\"Key\":")
+		buffer.WriteString(", \"Value\":")
+		if response.IsDelete {
+			buffer.WriteString("null")
+		} else {
+			buffer.WriteString(string(response.Value))
+		}
+
+		buffer.WriteString(", \"Timestamp\":")
 		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
+		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"IsDelete\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(strconv.FormatBool(response.IsDelete))
 		buffer.WriteString("\"")
 
-		buffer.WriteString(", \"Record\":")
-		buffer.WriteString(string(queryResponse.Value))
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
 	}
@@ -89,35 +259,44 @@ func (s *SmartContract) QueryAllBasicInfo(APIstub shim.ChaincodeStubInterface) s
 	return shim.Success(buffer.Bytes())
 }
 
-func (s *SmartContract) QueryBasicInfoByKeyValue(APIstub ChaincodeStubInterface, args []string) sc.Response {
-
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+//필드 하나가 값과 같은 정보를 찾는 함수 (basicInfoSchema에 없는 필드는 에러)
+func getQueryResultForKeyValue(APIstub shim.ChaincodeStubInterface, key string, value string) ([]byte, error) {
+	query, err := basicInfoSchema.Build(selector.Eq(key, value))
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"%s\"}", err.Error())
 	}
 
-	key := strings.ToLower(args[0])
-	key := strings.ToLower(args[1])
-	queryString := fmt.Sprintf("{\"selector\":{\"%s\":\"%s\"}}", key, value)
-
-	resultsIterator, err := APIstub.GetQueryResult(queryString)
+	resultsIterator, err := APIstub.GetQueryResult(query.String())
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.bufferbuffer.WriteString("[")
-	bArrayMemberAlreadyWritten := false
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
 
+	return buffer.Bytes(), nil
+}
+
+//iterator를 json으로 이쁘게 변환하기 위한 함수
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return nil, err
 		}
+
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
 		}
 
-		buffer.WriteString("{\"key\":")
+		buffer.WriteString("{\"Key\":")
 		buffer.WriteString("\"")
 		buffer.WriteString(queryResponse.Key)
 		buffer.WriteString("\"")
@@ -127,8 +306,14 @@ func (s *SmartContract) QueryBasicInfoByKeyValue(APIstub ChaincodeStubInterface,
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
 	}
-
 	buffer.WriteString("]")
 
-	return shim.Success(buffer.Bytes())
-}
\ No newline at end of file
+	return &buffer, nil
+}
+
+func main() {
+	err := shim.Start(new(SmartContract))
+	if err != nil {
+		fmt.Printf("Error creating new Smart Contract: %s", err)
+	}
+}
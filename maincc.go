@@ -7,17 +7,470 @@ import (
 	"strings"
 	"strconv"
 	"time"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/fabcar/go/fieldcrypt"
+	"github.com/fabcar/go/selector"
+	"github.com/fabcar/go/validate"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
 
 type SmartContract struct {
 }
 
+//MainInfo를 저장하는 composite key 종류 (공개 원장과 collection 모두 MainInfo~식별자)
+//다른 정보와 키가 겹치지 않고, 범위 조회에 다른 정보가 섞이지 않게 한다.
+const mainInfoObjectType = "MainInfo"
+
+//migrateMainInfoKeys 한 번에 옮길 수 있는 최대 개수
+const maxMigrationBatchSize = 100
+
+//migrateMainInfoKeys 결과
+type MainInfoKeyMigration struct {
+	Identifiers []string `json:"identifiers"`
+	MigratedCount int `json:"migratedCount"`
+	//MainInfo로 읽히지 않아 옮기지 않은 예전 키
+	SkippedKeys []string `json:"skippedKeys"`
+	//마지막으로 읽은 예전 키 (다음 호출의 startAfter로 넘긴다)
+	LastKey string `json:"lastKey"`
+	//한 번에 다 옮기지 못해 남은 정보가 있으면 true (다시 호출한다)
+	HasMore bool `json:"hasMore"`
+}
+
+//공개 원장에 올라가는 정보 (개인정보는 솔트를 넣은 해시만 남긴다)
 type MainInfo struct {
+	Hash string `json:"hash"`
+	//정보를 생성한 사람의 MSP ID와 인증서 주체
+	OwnerMSP string `json:"ownerMsp"`
+	OwnerSubject string `json:"ownerSubject"`
+	//이 값을 마지막으로 저장한 사람 (이력에서 누가 바꿨는지 보여줄 때 사용)
+	ModifiedByMSP string `json:"modifiedByMsp"`
+	ModifiedBySubject string `json:"modifiedBySubject"`
+	//저장할 때마다 1씩 늘어난다. (버전이 없던 예전 정보는 0)
+	Version int64 `json:"version"`
+	//마지막으로 저장한 트랜잭션 시각 (RFC3339 UTC)
+	UpdatedAt string `json:"updatedAt"`
+	//이 저장에서 바뀐 필드 이름
+	ChangedFields []string `json:"changedFields"`
+	//보유 기한을 정한 이용 목적 (목적 없이 기한만 넣었으면 빈 값)
+	RetentionPurpose string `json:"retentionPurpose,omitempty"`
+	//이 시각이 지나면 purgeExpiredMainInfo로 지운다. (RFC3339 UTC, 기한이 없던 예전 정보는 빈 값)
+	RetainUntil string `json:"retainUntil,omitempty"`
+}
+
+//getHistoryMainInfo가 돌려주는 이력 하나
+type MainInfoHistoryEntry struct {
+	TxId string `json:"txId"`
+	//RFC3339 UTC
+	Timestamp string `json:"timestamp"`
+	IsDelete bool `json:"isDelete"`
+	//삭제된 경우 null
+	Value *MainInfo `json:"value"`
+	SubmitterMSP string `json:"submitterMsp"`
+	SubmitterSubject string `json:"submitterSubject"`
+}
+
+//private data collection에만 저장하는 개인정보
+type MainInfoPrivate struct {
+	Name string `json:"name"`
+	Phone string `json:"phone"`
+	Id string `json:"id"`
+	Salt string `json:"salt"`
+	//name, phone, id를 암호화한 키 (암호화가 필수가 되기 전에 평문으로 저장한 정보면 빈 값)
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+	//검색용으로 맞춘 값 (암호화한 정보에는 두지 않는다)
+	Normalized *MainInfoNormalized `json:"normalized,omitempty"`
+	//필드별 블라인드 인덱스 값 (값이 바뀌거나 삭제할 때 예전 인덱스를 지우기 위해 둔다)
+	BlindIndexes map[string]string `json:"blindIndexes,omitempty"`
+}
+
+//관리자가 바꾼 검사 규칙을 저장하는 composite key 종류 (없으면 validate.DefaultRules)
+const validationRulesObjectType = "MainInfoValidationRules"
+
+//validate.Normalize로 맞춘 name, phone, id (쿼리는 이 값으로 찾는다)
+type MainInfoNormalized struct {
+	Name string `json:"name"`
+	Phone string `json:"phone"`
+	Id string `json:"id"`
+}
+
+//블라인드 인덱스를 만드는 필드 (composite key: 필드~hmac~식별자)
+var blindIndexFields = []string{"name", "phone", "id"}
+
+//블라인드 인덱스 HMAC 키를 collection에 저장하는 composite key 종류
+const blindIndexKeyObjectType = "MainInfoBlindIndexKey"
+
+//setBlindIndexKey에서 HMAC 키를 넣는 transient map 키
+const blindIndexKeyTransientKey = "blindIndexKey"
+
+//트랜잭션마다 저장해 두는 개인정보 사본 (시점 조회에 사용)
+//쿼리에 걸리지 않도록 개인정보는 info 아래에 넣는다.
+type MainInfoRevision struct {
+	TxId string `json:"txId"`
+	Info MainInfoPrivate `json:"info"`
+}
+
+//개인정보 사본의 composite key 종류
+const mainInfoRevisionObjectType = "MainInfoRevision"
+
+//개인정보를 파기했다는 기록 (composite key: MainInfoTombstone~식별자)
+//공개 원장에 남아서 누가 언제 파기했는지 증명한다.
+type MainInfoTombstone struct {
+	Identifier string `json:"identifier"`
+	//파기 직전 공개 원장의 해시 (솔트도 같이 지워지므로 되돌릴 수 없다)
+	LastHash string `json:"lastHash"`
+	Reason string `json:"reason"`
+	//파기한 private data 키 개수 (현재 값 + 사본)
+	PurgedKeys int `json:"purgedKeys"`
+	//파기 직전 정보를 암호화한 키 (체인코드는 키를 지웠는지 알 수 없다. 원장 밖에서 이 키와 rotateMainInfoKey로 바꾸기 전의 키를 지워야 이력의 private data까지 읽을 수 없게 된다)
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+	//파기한 키 중 암호화가 필수가 되기 전에 평문으로 저장된 키 개수 (0이 아니면 그 평문이 예전 write-set으로 peer에 남아 있다)
+	PlaintextKeys int `json:"plaintextKeys"`
+	ErasedAt string `json:"erasedAt"`
+	ErasedByMSP string `json:"erasedByMsp"`
+	ErasedBySubject string `json:"erasedBySubject"`
+	TxId string `json:"txId"`
+}
+
+//파기 기록의 composite key 종류
+const mainInfoTombstoneObjectType = "MainInfoTombstone"
+
+//특정 시점의 정보 (status: found, notFound, deleted)
+type MainInfoAsOf struct {
+	Identifier string `json:"identifier"`
+	AsOf string `json:"asOf"`
+	Status string `json:"status"`
+	//그 시점에 유효했던 값을 쓴 트랜잭션
+	TxId string `json:"txId,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Record *MainInfo `json:"record,omitempty"`
+	//이 변경 이전에 저장된 정보는 사본이 없어 null일 수 있다.
+	Info *MainInfoPrivate `json:"info,omitempty"`
+}
+
+//두 시점 사이에 바뀐 필드 하나
+type MainInfoFieldChange struct {
+	Field string `json:"field"`
+	Before string `json:"before"`
+	After string `json:"after"`
+}
+
+//diffMainInfo 결과
+type MainInfoDiff struct {
+	Identifier string `json:"identifier"`
+	From MainInfoAsOf `json:"from"`
+	To MainInfoAsOf `json:"to"`
+	Changes []MainInfoFieldChange `json:"changes"`
+}
+
+//정보 주체의 이용 목적별 동의 (composite key: Consent~식별자~목적)
+type Consent struct {
+	Identifier string `json:"identifier"`
+	Purpose string `json:"purpose"`
+	//보유 기간 (일)
+	RetentionDays int `json:"retentionDays"`
+	GrantedAt string `json:"grantedAt"`
+	ExpiresAt string `json:"expiresAt"`
+	//철회한 경우에만 채워진다. 철회해도 동의했던 증거로 남겨둔다.
+	WithdrawnAt string `json:"withdrawnAt,omitempty"`
+	RecordedByMSP string `json:"recordedByMsp"`
+	RecordedBySubject string `json:"recordedBySubject"`
+}
+
+//동의의 composite key 종류
+const consentObjectType = "Consent"
+
+//exportMyData 문서 형식 버전 (필드가 바뀌면 올린다)
+const mainInfoExportFormatVersion = 1
+
+//exportMyData가 돌려주는 문서
+type MainInfoExport struct {
+	FormatVersion int `json:"formatVersion"`
+	Identifier string `json:"identifier"`
+	GeneratedAt string `json:"generatedAt"`
+	//공개 원장의 현재 정보 (삭제했으면 null)
+	Record *MainInfo `json:"record"`
+	//collection의 현재 개인정보 (키를 넣지 않은 암호화 정보는 암호문 그대로)
+	Info *MainInfoPrivate `json:"info"`
+	History []MainInfoHistoryEntry `json:"history"`
+	//시점 조회용으로 보관한 예전 개인정보
+	Revisions []MainInfoRevision `json:"revisions"`
+	Consents []Consent `json:"consents"`
+	AccessLog []MainInfoAccessLogEntry `json:"accessLog"`
+	Tombstone *MainInfoTombstone `json:"tombstone,omitempty"`
+}
+
+//이용 목적별 보유 기간 정책 (composite key: MainInfoRetentionPolicy~목적)
+type RetentionPolicy struct {
+	Purpose string `json:"purpose"`
+	RetentionDays int `json:"retentionDays"`
+	UpdatedAt string `json:"updatedAt"`
+	UpdatedByMSP string `json:"updatedByMsp"`
+}
+
+//audited 조회로 열람을 허락받은 기록 (composite key: MainInfoAccessGrant~트랜잭션 ID)
+//invoke 결과는 블록에 남으므로 개인정보를 넣지 않고, commit된 뒤 getMainInfoByAccessGrant를 query로 호출해서 읽는다.
+//열람 기록 한 번을 나타내는 표시일 뿐 기한이나 횟수 제한은 없다. (query는 원장에 쓸 수 없고 query의 트랜잭션 시각은 클라이언트가 정한다)
+//같은 허락 기록으로 다시 읽어도 새 열람 기록은 남지 않으므로, 새로 열람할 때는 audited 함수를 다시 호출한다.
+type MainInfoAccessGrant struct {
+	TxId string `json:"txId"`
+	Identifiers []string `json:"identifiers"`
+	Purpose string `json:"purpose"`
+	Function string `json:"function"`
+	AccessorMSP string `json:"accessorMsp"`
+	AccessorSubject string `json:"accessorSubject"`
+	Timestamp string `json:"timestamp"`
+}
+
+//열람 허락 기록의 composite key 종류
+const mainInfoAccessGrantObjectType = "MainInfoAccessGrant"
+
+//queryMainInfoAudited, queryMainInfoBy*, queryMainInfoPage에서 찾을 값이나 쿼리를 넣는 transient map 키 (args에 넣으면 블록에 남는다)
+const mainInfoQueryTransientKey = "mainInfoQuery"
+
+//개인정보를 읽은 기록 하나 (composite key: MainInfoAccessLog~식별자~시각~트랜잭션 ID)
+//정보 주체가 누가 언제 어떤 목적으로 자기 정보를 봤는지 확인할 수 있도록 공개 원장에 남긴다.
+type MainInfoAccessLogEntry struct {
+	Identifier string `json:"identifier"`
+	AccessorMSP string `json:"accessorMsp"`
+	AccessorSubject string `json:"accessorSubject"`
+	AccessorRole string `json:"accessorRole"`
+	Purpose string `json:"purpose"`
+	Function string `json:"function"`
+	//검색해서 읽은 경우 검색한 필드 (값은 남기지 않는다)
+	QueryField string `json:"queryField,omitempty"`
+	Timestamp string `json:"timestamp"`
+	TxId string `json:"txId"`
+}
+
+//열람 기록의 composite key 종류
+const mainInfoAccessLogObjectType = "MainInfoAccessLog"
+
+//보유 기한 인덱스의 composite key 종류 (MainInfoRetainUntil~기한~식별자)
+//기한은 초 단위 UTC RFC3339라서 길이가 같고, 키 순서가 기한 순서가 된다.
+const mainInfoRetainUntilObjectType = "MainInfoRetainUntil"
+
+//보유 기간 정책의 composite key 종류
+const retentionPolicyObjectType = "MainInfoRetentionPolicy"
+
+//생성할 때 목적도 기한도 넣지 않으면 쓰는 정책의 목적
+const defaultRetentionPurpose = "default"
+
+//purgeExpiredMainInfo 한 번에 지울 수 있는 최대 개수 (트랜잭션 하나가 너무 커지지 않게 한다)
+const maxPurgeBatchSize = 100
+
+//보유 기한이 지난 정보를 지우는 방법
+const purgeModeDelete = "delete"
+const purgeModeErase = "erase"
+
+//purgeExpiredMainInfo 결과이자 이벤트 내용
+type MainInfoPurgeSummary struct {
+	EventType string `json:"eventType"`
+	Mode string `json:"mode"`
+	//이 시각까지 기한이 지난 정보를 지웠다.
+	AsOf string `json:"asOf"`
+	Identifiers []string `json:"identifiers"`
+	PurgedCount int `json:"purgedCount"`
+	//한 번에 다 지우지 못해 남은 정보가 있으면 true (다시 호출한다)
+	HasMore bool `json:"hasMore"`
+	ActorMSP string `json:"actorMsp"`
+	Timestamp string `json:"timestamp"`
+}
+
+//개인정보를 저장하는 private data collection 이름 (collections_config.json과 같아야 한다)
+const mainInfoCollection = "collectionMainInfoPrivate"
+
+//개인정보를 담아 보내는 transient map의 키
+const mainInfoTransientKey = "mainInfo"
+
+//개인정보를 암호화할 때 쓰는 AES-256 키를 넣는 transient map 키 (개인정보를 저장할 때는 반드시 넣어야 한다)
+const mainInfoKeyTransientKey = "mainInfoKey"
+
+//patchMainInfo에서 merge patch를 넣는 transient map 키
+const mainInfoPatchTransientKey = "mainInfoPatch"
+
+//merge patch로 바꿀 수 있는 필드 (null로 지우면 필수 필드 검사에서 거절된다)
+var patchableFields = map[string]bool{"name": true, "phone": true, "id": true, "salt": true}
+
+//batch 항목 배열을 넣는 transient map 키
+const mainInfoBatchTransientKey = "mainInfoBatch"
+
+//batch 항목 수 한도를 저장하는 composite key 종류 (없으면 defaultMainInfoBatchLimit)
+const mainInfoBatchLimitObjectType = "MainInfoBatchLimit"
+const defaultMainInfoBatchLimit = 100
+const maxMainInfoBatchLimit = 1000
+
+//createMainInfoBatch, updateMainInfoBatch의 항목 하나
+type MainInfoBatchItem struct {
+	Identifier string `json:"identifier"`
 	Name string `json:"name"`
 	Phone string `json:"phone"`
 	Id string `json:"id"`
+	Salt string `json:"salt"`
+	//updateMainInfoBatch에서만 쓴다.
+	ExpectedVersion *int64 `json:"expectedVersion,omitempty"`
+	//createMainInfoBatch에서만 쓴다.
+	RetentionPurpose string `json:"retentionPurpose,omitempty"`
+	RetainUntil string `json:"retainUntil,omitempty"`
+}
+
+//항목에서 개인정보만 꺼내는 함수
+func (item MainInfoBatchItem) mainInfoPrivate() MainInfoPrivate {
+	return MainInfoPrivate{Name: item.Name, Phone: item.Phone, Id: item.Id, Salt: item.Salt}
+}
+
+//batch 항목별 처리 결과
+const batchStatusCreated = "created"
+const batchStatusUpdated = "updated"
+const batchStatusAlreadyExists = "alreadyExists"
+const batchStatusNotFound = "notFound"
+const batchStatusValidationError = "validationError"
+//소유자, 버전, 키, 보유 기한 등이 맞지 않아 처리하지 않은 항목
+const batchStatusRejected = "rejected"
+//앞의 항목과 식별자가 같아 처리하지 않은 항목
+const batchStatusDuplicate = "duplicateInBatch"
+
+//batch 항목 하나의 결과
+type MainInfoBatchItemResult struct {
+	Index int `json:"index"`
+	Identifier string `json:"identifier"`
+	Status string `json:"status"`
+	ChangedFields []string `json:"changedFields,omitempty"`
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+//batch 결과 (counts는 상태별 항목 수)
+type MainInfoBatchResult struct {
+	Results []MainInfoBatchItemResult `json:"results"`
+	Counts map[string]int `json:"counts"`
+}
+
+//rotateMainInfoKey에서 새 키를 넣는 transient map 키
+const mainInfoNewKeyTransientKey = "mainInfoNewKey"
+
+//인증서에 담긴 역할 속성과 역할 종류
+const roleAttribute = "role"
+const adminRole = "admin"
+const registrarRole = "registrar"
+const auditorRole = "auditor"
+const subjectRole = "subject"
+
+//정보 주체가 자기 식별자를 담아 오는 인증서 속성
+const subjectIdentifierAttribute = "identifier"
+
+//함수별로 호출할 수 있는 역할 (여기에 없는 함수는 호출할 수 없다)
+var functionRoles = map[string][]string{
+	"createMainInfo":             {adminRole, registrarRole},
+	"updateMainInfo":             {adminRole, registrarRole},
+	"patchMainInfo":              {adminRole, registrarRole},
+	"createMainInfoBatch":        {adminRole, registrarRole},
+	"updateMainInfoBatch":        {adminRole, registrarRole},
+	"setMainInfoBatchLimit":      {adminRole},
+	"deleteMainInfo":             {adminRole, registrarRole},
+	"rotateMainInfoKey":          {adminRole, registrarRole},
+	"setBlindIndexKey":           {adminRole},
+	"setValidationRules":         {adminRole},
+	"getValidationRules":         {adminRole, registrarRole, auditorRole, subjectRole},
+	"reindexMainInfo":            {adminRole},
+	"eraseMainInfo":              {adminRole, registrarRole, subjectRole},
+	"getMainInfoTombstone":       {adminRole, auditorRole, subjectRole},
+	"getAllMainInfo":             {adminRole, registrarRole, auditorRole},
+	"getAllMainInfoPage":         {adminRole, registrarRole, auditorRole},
+	//정보 주체 본인 외에는 열람 기록을 남기고 열람 허락 기록만 돌려주는 함수로 찾은 뒤 getMainInfoByAccessGrant로 읽는다.
+	"getMainInfoByIdentifier":    {subjectRole},
+	"getHistoryMainInfo":         {adminRole, auditorRole, subjectRole},
+	//예전 개인정보를 열람 기록 없이 돌려주므로 정보 주체 본인만 호출할 수 있다.
+	"getMainInfoAsOf":            {subjectRole},
+	"diffMainInfo":               {subjectRole},
+	"grantConsent":               {adminRole, registrarRole, subjectRole},
+	"withdrawConsent":            {adminRole, registrarRole, subjectRole},
+	"getConsentsForMainInfo":     {adminRole, registrarRole, auditorRole, subjectRole},
+	"getMainInfoAudited":         {adminRole, registrarRole, auditorRole},
+	"queryMainInfoAudited":       {adminRole, registrarRole, auditorRole},
+	"queryMainInfoByName":        {adminRole, registrarRole, auditorRole},
+	"queryMainInfoByPhone":       {adminRole, registrarRole, auditorRole},
+	"queryMainInfoById":          {adminRole, registrarRole, auditorRole},
+	"queryMainInfoByQueryString": {adminRole, registrarRole, auditorRole},
+	"queryMainInfoPage":          {adminRole, registrarRole, auditorRole},
+	"getMainInfoByAccessGrant":   {adminRole, registrarRole, auditorRole},
+	"getAccessLogForMainInfo":    {adminRole, auditorRole, subjectRole},
+	//동의 확인과 열람 기록 없이 전부 돌려주므로 정보 주체 본인만 호출할 수 있다.
+	"exportMyData":               {subjectRole},
+	"migrateMainInfoKeys":        {adminRole},
+	"setRetentionPolicy":         {adminRole},
+	"getRetentionPolicies":       {adminRole, registrarRole, auditorRole},
+	"queryExpiredMainInfo":       {adminRole, auditorRole},
+	"purgeExpiredMainInfo":       {adminRole},
+}
+
+//페이지 하나에 가져올 수 있는 최대 개수
+const maxPageSize = 200
+
+//페이지 조회 결과에 들어가는 정보 하나
+type QueryRecord struct {
+	Key string `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+//페이지 조회 결과 (bookmark를 다음 호출에 넘기면 다음 페이지를 가져온다)
+type MainInfoPage struct {
+	Records []QueryRecord `json:"records"`
+	Bookmark string `json:"bookmark"`
+	FetchedCount int32 `json:"fetchedCount"`
+}
+
+//queryMainInfoPage 결과 (개인정보 대신 열람 허락 기록을 돌려준다)
+type MainInfoGrantPage struct {
+	Grant MainInfoAccessGrant `json:"grant"`
+	Bookmark string `json:"bookmark"`
+	FetchedCount int32 `json:"fetchedCount"`
+}
+
+//정보 생성/수정/삭제 때 보내는 이벤트 이름
+const mainInfoCreatedEvent = "MainInfoCreated"
+const mainInfoUpdatedEvent = "MainInfoUpdated"
+const mainInfoDeletedEvent = "MainInfoDeleted"
+const mainInfoErasedEvent = "MainInfoErased"
+const mainInfoKeyRotatedEvent = "MainInfoKeyRotated"
+const mainInfoExpiredPurgedEvent = "MainInfoExpiredPurged"
+
+//batch로 생성/수정한 식별자를 모아서 보내는 이벤트 이름
+const mainInfoBatchCreatedEvent = "MainInfoBatchCreated"
+const mainInfoBatchUpdatedEvent = "MainInfoBatchUpdated"
+
+//batch 이벤트 내용 (트랜잭션 하나에 이벤트는 하나만 남으므로 식별자를 모아서 보낸다)
+type MainInfoBatchEvent struct {
+	EventType string `json:"eventType"`
+	Identifiers []string `json:"identifiers"`
+	ActorMSP string `json:"actorMsp"`
+	Timestamp string `json:"timestamp"`
+}
+
+//이벤트 내용 (개인정보 값은 절대 넣지 않고 바뀐 필드 이름만 넣는다)
+type MainInfoEvent struct {
+	EventType string `json:"eventType"`
+	Identifier string `json:"identifier"`
+	ChangedFields []string `json:"changedFields"`
+	ActorMSP string `json:"actorMsp"`
+	Timestamp string `json:"timestamp"`
+}
+
+//수정하려는 버전이 지금 버전과 다를 때 돌려주는 에러
+type VersionConflict struct {
+	Error string `json:"Error"`
+	Identifier string `json:"identifier"`
+	ExpectedVersion int64 `json:"expectedVersion"`
+	CurrentVersion int64 `json:"currentVersion"`
+}
+
+//권한이 없는 호출에 돌려주는 에러
+type AccessDenied struct {
+	Error string `json:"Error"`
+	Function string `json:"function"`
+	Role string `json:"role"`
 }
 
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
@@ -27,72 +480,185 @@ func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
 func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
 	function, args := APIstub.GetFunctionAndParameters()
 
+	//역할표에 없는 함수는 호출할 수 없다.
+	if _, ok := functionRoles[function]; !ok {
+		return shim.Error("Invalid Smart Contract function name. ")
+	}
+
+	//호출한 사람의 역할로 이 함수를 부를 수 있는지 먼저 확인한다.
+	err := checkFunctionAccess(APIstub, function, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	if function == "createMainInfo" {
 		//개인정보 생성
 		return s.createMainInfo(APIstub, args)
 	} else if function == "getAllMainInfo" {
 		//원장의 모든 정보 가져오기
 		return s.getAllMainInfo(APIstub)
+	} else if function == "getAllMainInfoPage" {
+		//원장의 정보를 페이지 단위로 가져오기
+		return s.getAllMainInfoPage(APIstub, args)
 	} else if function == "getMainInfoByIdentifier" {
 		//식별자로 정보 가져오기
 		return s.getMainInfoByIdentifier(APIstub, args)
+	} else if function == "getMainInfoAudited" {
+		//식별자로 정보 가져오고 열람 기록 남기기 (트랜잭션으로 호출)
+		return s.getMainInfoAudited(APIstub, args)
+	} else if function == "queryMainInfoAudited" {
+		//이름, 연락처, 아이디로 정보 가져오고 열람 기록 남기기 (트랜잭션으로 호출)
+		return s.queryMainInfoAudited(APIstub, args)
+	} else if function == "getMainInfoByAccessGrant" {
+		//열람 기록을 남긴 트랜잭션으로 정보 가져오기 (query로 호출)
+		return s.getMainInfoByAccessGrant(APIstub, args)
+	} else if function == "getAccessLogForMainInfo" {
+		//식별자의 열람 기록 가져오기
+		return s.getAccessLogForMainInfo(APIstub, args)
 	} else if function == "queryMainInfoByName" {
-		//이름으로 정보가져오기
+		//이름으로 찾고 열람 기록 남기기 (트랜잭션으로 호출)
 		return s.queryMainInfoByName(APIstub, args)
 	} else if function == "queryMainInfoByPhone" {
-		//연락처로 정보 가져오기
+		//연락처로 찾고 열람 기록 남기기 (트랜잭션으로 호출)
 		return s.queryMainInfoByPhone(APIstub, args)
 	} else if function == "queryMainInfoById" {
-		//아이디로 정보 가져오기
+		//아이디로 찾고 열람 기록 남기기 (트랜잭션으로 호출)
 		return s.queryMainInfoById(APIstub, args)
 	} else if function == "queryMainInfoByQueryString" {
-		//쿼리로 정보 가져오기
+		//쿼리로 찾고 열람 기록 남기기 (트랜잭션으로 호출)
 		return s.queryMainInfoByQueryString(APIstub, args)
+	} else if function == "queryMainInfoPage" {
+		//쿼리 결과를 페이지 단위로 찾고 열람 기록 남기기 (트랜잭션으로 호출)
+		return s.queryMainInfoPage(APIstub, args)
 	} else if  function == "getHistoryMainInfo" {
 		//정보 이력 가져오기
 		return s.getHistoryMainInfo(APIstub, args)
+	} else if function == "getMainInfoAsOf" {
+		//특정 시점의 정보 가져오기
+		return s.getMainInfoAsOf(APIstub, args)
+	} else if function == "diffMainInfo" {
+		//두 시점 사이에 바뀐 필드 가져오기
+		return s.diffMainInfo(APIstub, args)
+	} else if function == "grantConsent" {
+		//이용 목적에 동의하기
+		return s.grantConsent(APIstub, args)
+	} else if function == "withdrawConsent" {
+		//동의 철회하기
+		return s.withdrawConsent(APIstub, args)
+	} else if function == "getConsentsForMainInfo" {
+		//식별자의 동의 목록 가져오기
+		return s.getConsentsForMainInfo(APIstub, args)
 	} else if function == "updateMainInfo" {
 		//정보 수정하기
 		return s.updateMainInfo(APIstub, args)
+	} else if function == "createMainInfoBatch" {
+		//여러 정보를 한 번에 생성하기 (항목별 결과)
+		return s.createMainInfoBatch(APIstub)
+	} else if function == "updateMainInfoBatch" {
+		//여러 정보를 한 번에 수정하기 (항목별 결과)
+		return s.updateMainInfoBatch(APIstub)
+	} else if function == "setMainInfoBatchLimit" {
+		//batch 항목 수 한도 바꾸기
+		return s.setMainInfoBatchLimit(APIstub, args)
+	} else if function == "patchMainInfo" {
+		//merge patch로 정보 수정하기 (필드 지우기 가능)
+		return s.patchMainInfo(APIstub, args)
 	} else if function == "deleteMainInfo" {
 		//정보 삭제하기
 		return s.deleteMainInfo(APIstub, args)
+	} else if function == "rotateMainInfoKey" {
+		//개인정보를 새 키로 다시 암호화하기
+		return s.rotateMainInfoKey(APIstub, args)
+	} else if function == "setValidationRules" {
+		//개인정보 검사 규칙 바꾸기
+		return s.setValidationRules(APIstub, args)
+	} else if function == "getValidationRules" {
+		//개인정보 검사 규칙 가져오기
+		return s.getValidationRules(APIstub)
+	} else if function == "setBlindIndexKey" {
+		//블라인드 인덱스 키 저장하기
+		return s.setBlindIndexKey(APIstub)
+	} else if function == "reindexMainInfo" {
+		//블라인드 인덱스 다시 만들기
+		return s.reindexMainInfo(APIstub, args)
+	} else if function == "eraseMainInfo" {
+		//정보 주체의 요청으로 개인정보 파기하기
+		return s.eraseMainInfo(APIstub, args)
+	} else if function == "getMainInfoTombstone" {
+		//파기 기록 가져오기
+		return s.getMainInfoTombstone(APIstub, args)
+	} else if function == "exportMyData" {
+		//정보 주체의 정보를 한 번에 내보내기
+		return s.exportMyData(APIstub, args)
+	} else if function == "migrateMainInfoKeys" {
+		//예전 키로 저장한 정보를 MainInfo composite key로 옮기기
+		return s.migrateMainInfoKeys(APIstub, args)
+	} else if function == "setRetentionPolicy" {
+		//이용 목적별 보유 기간 정하기
+		return s.setRetentionPolicy(APIstub, args)
+	} else if function == "getRetentionPolicies" {
+		//보유 기간 정책 목록 가져오기
+		return s.getRetentionPolicies(APIstub)
+	} else if function == "queryExpiredMainInfo" {
+		//보유 기한이 지난 정보 가져오기
+		return s.queryExpiredMainInfo(APIstub, args)
+	} else if function == "purgeExpiredMainInfo" {
+		//보유 기한이 지난 정보 지우기
+		return s.purgeExpiredMainInfo(APIstub, args)
 	}
 
 	return shim.Error("Invalid Smart Contract function name. ")
 }
 
 // 개인정보 생성 함수
+// args: 식별자, 보유 목적(선택), 보유 기한(RFC3339, 선택)
+// 기한을 넣으면 그 기한을, 아니면 보유 목적(없으면 default)의 정책으로 기한을 정한다.
+// transient: mainInfo = {"name","phone","id","salt"}, mainInfoKey = 암호화 키
 func (s *SmartContract) createMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 3")
 	}
 
-	//같은 식별자로 등록되어 있는것이 있는지 확인한다.
-	resultsAsBytes, _ := APIstub.GetState(args[0])
-	if resultsAsBytes != nil {
-		return shim.Error("Already exists!!!")
+	retentionPurpose, retainUntil := "", ""
+	if len(args) == 3 {
+		retentionPurpose, retainUntil = args[1], args[2]
+	}
+
+	//개인정보는 proposal에 남지 않도록 transient map으로 받는다.
+	mainInfoPrivate, err := getMainInfoFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//파기할 때 키만 지우면 되도록 항상 암호화해서 저장한다.
+	key, err := requireMainInfoKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, err = createMainInfoRecord(APIstub, args[0], mainInfoPrivate, retentionPurpose, retainUntil, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoCreatedEvent, args[0], []string{"name", "phone", "id"})
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	
-	var mainInfo = MainInfo{Name: args[1], Phone: args[2], Id: args[3]}
-	mainInfoAsBytes, _ := json.Marshal(mainInfo)
-	APIstub.PutState(args[0], mainInfoAsBytes)
 
 	return shim.Success(nil)
 }
 
 func (s *SmartContract) getAllMainInfo(APIstub shim.ChaincodeStubInterface) sc.Response {
-	startKey := ""
-	endKey := ""
-
-	resultsIterator, err := APIstub.GetStateByRange(startKey, endKey)
+	//MainInfo 키만 읽어서 동의, 인덱스 같은 다른 정보가 섞이지 않게 한다.
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(mainInfoObjectType, []string{})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	defer resultsIterator.Close()
 
 	//json으로 이쁘게 변환함
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	buffer, err := constructQueryResponseFromIterator(APIstub, resultsIterator)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -100,250 +666,3389 @@ func (s *SmartContract) getAllMainInfo(APIstub shim.ChaincodeStubInterface) sc.R
 	return shim.Success(buffer.Bytes())
 }
 
-//식별자로 정보 가져오는 함수
-func (s *SmartContract) getMainInfoByIdentifier(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of argument. Excepting 1")
+//원장의 정보를 페이지 단위로 가져오는 함수
+// args: 페이지 크기, bookmark(처음엔 빈 값)
+func (s *SmartContract) getAllMainInfoPage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
-	mainInfoAsBytes, _ := APIstub.GetState(args[0])
-
-	return shim.Success(mainInfoAsBytes)
-}
+	pageSize, err := parsePageSize(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-//이름으로 정보 가져오는 함수
-func (s *SmartContract) queryMainInfoByName(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	resultsIterator, metadata, err := APIstub.GetStateByPartialCompositeKeyWithPagination(mainInfoObjectType, []string{}, pageSize, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	defer resultsIterator.Close()
 
-	name := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"name\":\"%s\"}}", name)
-	
-	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
+	//공개 원장에는 해시만 있으므로 동의 확인 없이 돌려준다.
+	records, _, err := collectQueryRecords(APIstub, resultsIterator, pageSize, nil)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(queryResults)
+
+	pageAsBytes, _ := json.Marshal(MainInfoPage{Records: records, Bookmark: metadata.Bookmark, FetchedCount: metadata.FetchedRecordsCount})
+	return shim.Success(pageAsBytes)
 }
 
-//연락처로 정보 가져오는 함수
-func (s *SmartContract) queryMainInfoByPhone(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments, Excepting 1")
+//쿼리 결과를 페이지 단위로 찾아서 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+//개인정보 collection은 페이지 API가 없어서 키 순서로 정렬하고 bookmark(마지막 키) 뒤부터 가져온다.
+//예전 키와 composite key가 섞여 있어도 끝나도록 bookmark는 식별자가 아니라 원래 키를 hex로 인코딩해서 돌려준다.
+//키 순서 정렬은 기본 인덱스(_all_docs)로만 되므로 여기서는 use_index를 넣지 않는다.
+//쿼리에 찾을 값이 들어 있으므로 블록에 남지 않도록 transient map으로 받는다.
+// args: 페이지 크기, bookmark(처음엔 빈 값), 이용 목적, transient: mainInfoQuery = 쿼리
+func (s *SmartContract) queryMainInfoPage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
-	phone := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"phone\":\"%s\"}}", phone)
-
-	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
+	queryArg, err := getMainInfoQueryFromTransient(APIstub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(queryResults)
-}
 
-//아이디로 정보 가져오는 함수
-func (s *SmartContract) queryMainInfoById(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	condition, err := mainInfoSchema.Parse(queryArg)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid query: " + err.Error() + "\"}")
 	}
+	condition = toNormalizedCondition(condition)
 
-	id := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"id\":\"%s\"}}", id)
-
-	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
+	pageSize, err := parsePageSize(args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(queryResults)
-}
 
-//쿼리로 정보 가져오기
-func (s *SmartContract) queryMainInfoByQueryString(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	bookmark := args[1]
+	if bookmark != "" {
+		bookmarkKey, err := hex.DecodeString(bookmark)
+		if err != nil || len(bookmarkKey) == 0 {
+			return shim.Error("{\"Error\":\"bookmark is invalid\"}")
+		}
+		condition = selector.And(condition, selector.KeyAfter(string(bookmarkKey)))
 	}
 
-	queryString := strings.ToLower(args[0])
+	query, err := mainInfoNormalizedSchema.Build(condition)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid query: " + err.Error() + "\"}")
+	}
 
-	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
+	resultsIterator, err := APIstub.GetPrivateDataQueryResult(mainInfoCollection, query.SortByKey().String())
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(queryResults)
-}
+	defer resultsIterator.Close()
 
-//식별자에 해당하는 정보의 이력 가져오기
-func (s *SmartContract) getHistoryMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of argument. Expecting 1")
+	//목적에 동의하지 않은 정보는 건너뛰고, bookmark는 마지막으로 읽은 키로 한다.
+	records, lastKey, err := collectQueryRecords(APIstub, resultsIterator, pageSize, consentFilter(APIstub, args[2]))
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	identifier := args[0]
+	identifiers := []string{}
+	for _, record := range records {
+		identifiers = append(identifiers, record.Key)
+	}
 
-	resultsIterator, err := APIstub.GetHistoryForKey(identifier)
+	grant, err := grantMainInfoAccess(APIstub, identifiers, args[2], "queryMainInfoPage", "")
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer resultsIterator.Close()
-
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
-		}
-		buffer.WriteString("{\"TxId\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(response.TxId)
-		buffer.WriteString("\"")
 
-		buffer.WriteString(", \"Value\":")
-		if response.IsDelete {
-			buffer.WriteString("null")
-		} else {
-			buffer.WriteString(string(response.Value))
-		}
+	page := MainInfoGrantPage{Grant: grant, Bookmark: bookmark, FetchedCount: int32(len(records))}
+	if lastKey != "" {
+		page.Bookmark = hex.EncodeToString([]byte(lastKey))
+	}
 
-		buffer.WriteString(", \"Timestamp\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
-		buffer.WriteString("\"")
+	pageAsBytes, _ := json.Marshal(page)
+	return shim.Success(pageAsBytes)
+}
 
-		buffer.WriteString(", \"IsDelete\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(strconv.FormatBool(response.IsDelete))
-		buffer.WriteString("\"")
+//식별자로 정보 가져오는 함수 (collection에 참여한 조직만 개인정보를 읽을 수 있다)
+// args: 식별자, 이용 목적
+func (s *SmartContract) getMainInfoByIdentifier(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of argument. Excepting 2")
+	}
 
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+	mainInfoAsBytes, err := readMainInfoPrivate(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	buffer.WriteString("]")
 
-	return shim.Success(buffer.Bytes())
+	return shim.Success(mainInfoAsBytes)
 }
 
-//정보 수정을 위한 함수
-func (s *SmartContract) updateMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+//식별자의 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+//결과에는 개인정보를 넣지 않는다. commit된 뒤 돌려받은 txId로 getMainInfoByAccessGrant를 query로 호출해서 읽는다.
+// args: 식별자, 이용 목적
+func (s *SmartContract) getMainInfoAudited(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
-	mainInfoAsBytes, err := APIstub.GetState(args[0])
+	err := checkConsent(APIstub, args[0], args[1])
 	if err != nil {
 		return shim.Error(err.Error())
-	} else if mainInfoAsBytes == nil {
-		return shim.Error("Info does not exist")
 	}
 
-	mainInfo := MainInfo{}
-	json.Unmarshal(mainInfoAsBytes, &mainInfo)
-
-	if args[1] != "" {
-		mainInfo.Name = args[1]
+	mainInfoAsBytes, err := getMainInfoState(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if mainInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + args[0] + "\"}")
 	}
 
-	if args[2] != "" {
-		mainInfo.Phone = args[2]
+	grant, err := grantMainInfoAccess(APIstub, []string{args[0]}, args[1], "getMainInfoAudited", "")
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	if args[3] != "" {
-		mainInfo.Id = args[3]
+	grantAsBytes, _ := json.Marshal(grant)
+	return shim.Success(grantAsBytes)
+}
+
+//이름, 연락처, 아이디로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+//찾을 값도 블록에 남지 않도록 transient map으로 받는다.
+// args: 필드(name, phone, id), 이용 목적, transient: mainInfoQuery = 찾을 값
+func (s *SmartContract) queryMainInfoAudited(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
-	mainInfoAsBytes, _ = json.Marshal(mainInfo)
-	APIstub.PutState(args[0], mainInfoAsBytes)
+	field := args[0]
+	indexed := false
+	for _, blindIndexField := range blindIndexFields {
+		if blindIndexField == field {
+			indexed = true
+		}
+	}
+	if !indexed {
+		return shim.Error("{\"Error\":\"field must be name, phone or id\"}")
+	}
 
-	return shim.Success(nil)
+	return auditMainInfoByBlindIndex(APIstub, field, args[1], "queryMainInfoAudited")
 }
 
-//정보를 삭제하는 함수
-func (s *SmartContract) deleteMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response{
-	var jsonResp string
-	var mainInfoJSON MainInfo
+//열람 기록을 남긴 트랜잭션으로 정보를 가져오는 함수 (query로만 호출한다. invoke로 호출하면 결과가 블록에 남는다)
+//허락 기록은 commit된 뒤에만 보이므로 열람 기록 없이 읽을 수 없고, 허락받은 사람만 읽을 수 있다.
+//query로는 읽은 횟수나 시각을 원장에 남길 수 없으므로 허락 기록에는 기한을 두지 않는다. (MainInfoAccessGrant 참고)
+// args: getMainInfoAudited, queryMainInfoAudited, queryMainInfoBy*, queryMainInfoPage가 돌려준 txId, transient: mainInfoKey = 암호화 키(선택)
+func (s *SmartContract) getMainInfoByAccessGrant(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	identifier := args[0]
-
-	valAsBytes, err := APIstub.GetState(identifier)
+	grantKey, err := APIstub.CreateCompositeKey(mainInfoAccessGrantObjectType, []string{args[0]})
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + identifier + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsBytes == nil {
-		jsonResp = "{\"Error\":\"identifier does not exist: " + identifier + "\"}"
-		return shim.Error(jsonResp)
+		return shim.Error(err.Error())
 	}
-
-	err = json.Unmarshal([]byte(valAsBytes), &mainInfoJSON)
+	grantAsBytes, err := APIstub.GetState(grantKey)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}"
-		return shim.Error(jsonResp)
+		return shim.Error(err.Error())
+	} else if grantAsBytes == nil {
+		return shim.Error("{\"Error\":\"access grant does not exist or is not committed yet: " + args[0] + "\"}")
 	}
 
-	err = APIstub.DelState(identifier)
+	var grant MainInfoAccessGrant
+	err = json.Unmarshal(grantAsBytes, &grant)
 	if err != nil {
-		return shim.Error("Failed to delete state : " + err.Error())
+		return shim.Error("{\"Error\":\"Failed to decode access grant: " + args[0] + "\"}")
 	}
 
-	return shim.Success(nil)
-}
-
-//iterator를 json으로 이쁘게 변환하기 위한 함수
-func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+	accessorMSP, accessorSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if grant.AccessorMSP != accessorMSP || grant.AccessorSubject != accessorSubject {
+		return shim.Error("{\"Error\":\"access grant belongs to another accessor: " + args[0] + "\"}")
+	}
 
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+	//허락받은 뒤 동의를 철회했거나 지운 정보는 빼고 돌려준다.
+	records := []QueryRecord{}
+	for _, identifier := range grant.Identifiers {
+		consented, err := hasConsent(APIstub, identifier, grant.Purpose)
 		if err != nil {
-			return nil, err
+			return shim.Error(err.Error())
+		} else if !consented {
+			continue
 		}
-		
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+
+		mainInfoAsBytes, err := readMainInfoPrivate(APIstub, identifier, grant.Purpose)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if mainInfoAsBytes == nil {
+			continue
 		}
+		records = append(records, QueryRecord{Key: identifier, Record: mainInfoAsBytes})
+	}
 
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
+	recordsAsBytes, _ := json.Marshal(records)
+	return shim.Success(recordsAsBytes)
+}
 
-		buffer.WriteString(", \"Record\":")
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+//식별자의 열람 기록을 오래된 순서로 가져오는 함수
+// args: 식별자
+func (s *SmartContract) getAccessLogForMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	entries, err := getMainInfoAccessLog(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	entriesAsBytes, _ := json.Marshal(entries)
+	return shim.Success(entriesAsBytes)
+}
+
+//이름으로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+// args: 이용 목적, transient: mainInfoQuery = 이름
+func (s *SmartContract) queryMainInfoByName(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	//평문을 couchDB selector로 보내지 않고 블라인드 인덱스로 찾는다.
+	return auditMainInfoByBlindIndex(APIstub, "name", args[0], "queryMainInfoByName")
+}
+
+//연락처로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+// args: 이용 목적, transient: mainInfoQuery = 연락처
+func (s *SmartContract) queryMainInfoByPhone(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	//평문을 couchDB selector로 보내지 않고 블라인드 인덱스로 찾는다.
+	return auditMainInfoByBlindIndex(APIstub, "phone", args[0], "queryMainInfoByPhone")
+}
+
+//아이디로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+// args: 이용 목적, transient: mainInfoQuery = 아이디
+func (s *SmartContract) queryMainInfoById(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	//평문을 couchDB selector로 보내지 않고 블라인드 인덱스로 찾는다.
+	return auditMainInfoByBlindIndex(APIstub, "id", args[0], "queryMainInfoById")
+}
+
+//쿼리로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수 (invoke로 호출한다)
+//쿼리에 찾을 값이 들어 있으므로 블록에 남지 않도록 transient map으로 받는다.
+// args: 이용 목적, transient: mainInfoQuery = 쿼리
+func (s *SmartContract) queryMainInfoByQueryString(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	queryArg, err := getMainInfoQueryFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//허용한 필드와 연산자만 쓸 수 있도록 검사한 뒤 다시 만든다.
+	condition, err := mainInfoSchema.Parse(queryArg)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid query: " + err.Error() + "\"}")
+	}
+	queryString, err := buildMainInfoQuery(condition)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	identifiers, err := findMainInfoIdentifiersByQuery(APIstub, queryString, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	grant, err := grantMainInfoAccess(APIstub, identifiers, args[0], "queryMainInfoByQueryString", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	grantAsBytes, _ := json.Marshal(grant)
+	return shim.Success(grantAsBytes)
+}
+
+//블라인드 인덱스로 찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 돌려주는 함수
+func auditMainInfoByBlindIndex(APIstub shim.ChaincodeStubInterface, field string, purpose string, function string) sc.Response {
+	value, err := getMainInfoQueryFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	identifiers, err := findMainInfoIdentifiersByBlindIndex(APIstub, field, value, purpose)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	grant, err := grantMainInfoAccess(APIstub, identifiers, purpose, function, field)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	grantAsBytes, _ := json.Marshal(grant)
+	return shim.Success(grantAsBytes)
+}
+
+//transient map에서 찾을 값이나 쿼리를 꺼내는 함수
+func getMainInfoQueryFromTransient(APIstub shim.ChaincodeStubInterface) (string, error) {
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	value, ok := transientMap[mainInfoQueryTransientKey]
+	if !ok || len(value) == 0 {
+		return "", fmt.Errorf("{\"Error\":\"%s must be a key in the transient map\"}", mainInfoQueryTransientKey)
+	}
+
+	return string(value), nil
+}
+
+//식별자에 해당하는 정보의 이력 가져오기 (오래된 것부터)
+// args: 식별자, (선택) 시작 시각, 끝 시각(RFC3339), 최대 개수 - 안 쓰는 조건은 빈 값
+func (s *SmartContract) getHistoryMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) < 1 || len(args) > 4 {
+		return shim.Error("Incorrect number of argument. Expecting 1 to 4")
+	}
+
+	identifier := args[0]
+
+	var from, to time.Time
+	var err error
+	if len(args) > 1 && args[1] != "" {
+		from, err = time.Parse(time.RFC3339, args[1])
+		if err != nil {
+			return shim.Error("{\"Error\":\"from must be an RFC3339 timestamp\"}")
+		}
+	}
+	if len(args) > 2 && args[2] != "" {
+		to, err = time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error("{\"Error\":\"to must be an RFC3339 timestamp\"}")
+		}
+	}
+	maxEntries := 0
+	if len(args) > 3 && args[3] != "" {
+		maxEntries, err = strconv.Atoi(args[3])
+		if err != nil || maxEntries <= 0 {
+			return shim.Error("{\"Error\":\"max entries must be a positive number\"}")
+		}
+	}
+
+	history, err := getMainInfoHistory(APIstub, identifier, from, to, maxEntries)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyAsBytes, _ := json.Marshal(history)
+	return shim.Success(historyAsBytes)
+}
+
+//정보 주체가 요청하면 보관하고 있는 정보를 한 번에 내보내는 함수 (개인정보 열람 요구 대응)
+//현재 정보, 변경 이력, 시점 조회용 사본, 동의, 열람 기록을 formatVersion이 붙은 문서 하나로 돌려준다.
+//본인의 권리 행사이므로 이용 목적 동의는 확인하지 않는다. 그래서 정보 주체 본인만 호출할 수 있다.
+// args: 식별자, transient: mainInfoKey = 암호화 키(선택)
+func (s *SmartContract) exportMyData(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	identifier := args[0]
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	export := MainInfoExport{
+		FormatVersion: mainInfoExportFormatVersion,
+		Identifier: identifier,
+		GeneratedAt: txTime.Format(time.RFC3339Nano),
+	}
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if mainInfoAsBytes != nil {
+		export.Record = &MainInfo{}
+		err = json.Unmarshal(mainInfoAsBytes, export.Record)
+		if err != nil {
+			return shim.Error("{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}")
+		}
+	}
+
+	key, err := getMainInfoKeyFromTransient(APIstub, mainInfoKeyTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	privateAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get private data for " + identifier + "\"}")
+	} else if privateAsBytes != nil {
+		export.Info = &MainInfoPrivate{}
+		err = json.Unmarshal(privateAsBytes, export.Info)
+		if err != nil {
+			return shim.Error("{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}")
+		}
+		err = exportMainInfoPrivate(export.Info, identifier, key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	export.History, err = getMainInfoHistory(APIstub, identifier, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	export.Revisions, err = getMainInfoRevisions(APIstub, identifier, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	export.Consents, err = getConsents(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	export.AccessLog, err = getMainInfoAccessLog(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	export.Tombstone, err = getMainInfoTombstone(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if export.Record == nil && export.Info == nil && len(export.History) == 0 {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + identifier + "\"}")
+	}
+
+	exportAsBytes, _ := json.Marshal(export)
+	return shim.Success(exportAsBytes)
+}
+
+//특정 시점에 유효했던 정보를 가져오는 함수 (정보 주체 본인만)
+// args: 식별자, 시각(RFC3339), 이용 목적
+func (s *SmartContract) getMainInfoAsOf(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	err := checkConsent(APIstub, args[0], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	asOf, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("{\"Error\":\"timestamp must be an RFC3339 timestamp\"}")
+	}
+
+	mainInfoAsOf, err := resolveMainInfoAsOf(APIstub, args[0], asOf)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mainInfoAsOfAsBytes, _ := json.Marshal(mainInfoAsOf)
+	return shim.Success(mainInfoAsOfAsBytes)
+}
+
+//두 시점 사이에 바뀐 필드를 가져오는 함수 (정보 주체 본인만)
+// args: 식별자, 시각1, 시각2(RFC3339), 이용 목적
+func (s *SmartContract) diffMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	err := checkConsent(APIstub, args[0], args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	t1, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("{\"Error\":\"t1 must be an RFC3339 timestamp\"}")
+	}
+	t2, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return shim.Error("{\"Error\":\"t2 must be an RFC3339 timestamp\"}")
+	}
+
+	from, err := resolveMainInfoAsOf(APIstub, args[0], t1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := resolveMainInfoAsOf(APIstub, args[0], t2)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//없거나 삭제된 시점은 모든 필드가 빈 값인 것으로 비교한다.
+	before := MainInfoPrivate{}
+	if from.Info != nil {
+		before = *from.Info
+	}
+	after := MainInfoPrivate{}
+	if to.Info != nil {
+		after = *to.Info
+	}
+
+	diff := MainInfoDiff{Identifier: args[0], From: from, To: to, Changes: []MainInfoFieldChange{}}
+	if before.Name != after.Name {
+		diff.Changes = append(diff.Changes, MainInfoFieldChange{Field: "name", Before: before.Name, After: after.Name})
+	}
+	if before.Phone != after.Phone {
+		diff.Changes = append(diff.Changes, MainInfoFieldChange{Field: "phone", Before: before.Phone, After: after.Phone})
+	}
+	if before.Id != after.Id {
+		diff.Changes = append(diff.Changes, MainInfoFieldChange{Field: "id", Before: before.Id, After: after.Id})
+	}
+
+	diffAsBytes, _ := json.Marshal(diff)
+	return shim.Success(diffAsBytes)
+}
+
+//이용 목적에 대한 동의를 남기는 함수 (같은 목적으로 다시 동의하면 새 동의로 바뀐다)
+// args: 식별자, 이용 목적, 만료 시각(RFC3339), 보유 기간(일)
+func (s *SmartContract) grantConsent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	identifier := args[0]
+	purpose := args[1]
+	if purpose == "" {
+		return shim.Error("{\"Error\":\"purpose must not be empty\"}")
+	}
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if mainInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + identifier + "\"}")
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, args[2])
+	if err != nil || !expiresAt.After(txTime) {
+		return shim.Error("{\"Error\":\"expiresAt must be a future RFC3339 timestamp\"}")
+	}
+
+	retentionDays, err := strconv.Atoi(args[3])
+	if err != nil || retentionDays <= 0 {
+		return shim.Error("{\"Error\":\"retention days must be a positive number\"}")
+	}
+
+	recordedByMSP, recordedBySubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	consent := Consent{
+		Identifier: identifier,
+		Purpose: purpose,
+		RetentionDays: retentionDays,
+		GrantedAt: txTime.Format(time.RFC3339Nano),
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339Nano),
+		RecordedByMSP: recordedByMSP,
+		RecordedBySubject: recordedBySubject,
+	}
+
+	err = putConsent(APIstub, consent)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//동의를 철회하는 함수
+// args: 식별자, 이용 목적
+func (s *SmartContract) withdrawConsent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	consent, err := getConsent(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if consent == nil {
+		return shim.Error("{\"Error\":\"consent does not exist: " + args[0] + ", " + args[1] + "\"}")
+	} else if consent.WithdrawnAt != "" {
+		return shim.Error("{\"Error\":\"consent is already withdrawn\"}")
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consent.WithdrawnAt = txTime.Format(time.RFC3339Nano)
+
+	consent.RecordedByMSP, consent.RecordedBySubject, err = getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putConsent(APIstub, *consent)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//식별자의 동의 목록을 가져오는 함수
+func (s *SmartContract) getConsentsForMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	consents, err := getConsents(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	consentsAsBytes, _ := json.Marshal(consents)
+	return shim.Success(consentsAsBytes)
+}
+
+//정보 수정을 위한 함수
+// args: 식별자, 수정하기 전에 읽은 버전
+// transient: mainInfo = 바꿀 항목만 채운 {"name","phone","id","salt"}, mainInfoKey = 암호화 키
+//암호화하지 않은 예전 정보는 이번 수정부터 암호화해서 저장한다.
+func (s *SmartContract) updateMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	update, err := getMainInfoFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, changedFields, err := updateMainInfoRecord(APIstub, args[0], args[1], update)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoUpdatedEvent, args[0], changedFields)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//여러 정보를 트랜잭션 하나로 생성하는 함수
+//잘못된 항목이 있어도 전체를 실패시키지 않고 항목별 결과(created, alreadyExists, validationError ...)를 돌려준다.
+// transient: mainInfoBatch = [{"identifier","name","phone","id","salt","retentionPurpose","retainUntil"}, ...]
+//            mainInfoKey = 암호화 키 (모든 항목에 쓴다)
+func (s *SmartContract) createMainInfoBatch(APIstub shim.ChaincodeStubInterface) sc.Response {
+	items, err := getMainInfoBatchFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := requireMainInfoKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	batch := newMainInfoBatchResult(len(items))
+	for index, item := range items {
+		result := MainInfoBatchItemResult{Index: index, Identifier: item.Identifier}
+		if batch.seen[item.Identifier] {
+			//같은 트랜잭션에서 쓴 값은 다시 읽을 수 없으므로 이미 쓴 식별자는 다시 처리하지 않는다.
+			result.Status = batchStatusDuplicate
+		} else {
+			result.Status, err = createMainInfoRecord(APIstub, item.Identifier, item.mainInfoPrivate(), item.RetentionPurpose, item.RetainUntil, key)
+			if result.Status == "" {
+				return shim.Error(err.Error())
+			}
+			result.Error = batchItemError(err)
+			if err == nil {
+				result.ChangedFields = []string{"name", "phone", "id"}
+			}
+		}
+		batch.add(result)
+	}
+
+	return batch.response(APIstub, mainInfoBatchCreatedEvent)
+}
+
+//여러 정보를 트랜잭션 하나로 수정하는 함수 (updateMainInfo처럼 빈 필드는 바꾸지 않는다)
+// transient: mainInfoBatch = [{"identifier","expectedVersion","name","phone","id","salt"}, ...]
+//            mainInfoKey = 암호화 키
+func (s *SmartContract) updateMainInfoBatch(APIstub shim.ChaincodeStubInterface) sc.Response {
+	items, err := getMainInfoBatchFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	batch := newMainInfoBatchResult(len(items))
+	for index, item := range items {
+		result := MainInfoBatchItemResult{Index: index, Identifier: item.Identifier}
+		if batch.seen[item.Identifier] {
+			result.Status = batchStatusDuplicate
+		} else if item.ExpectedVersion == nil {
+			result.Status = batchStatusRejected
+			result.Error = batchItemError(fmt.Errorf("{\"Error\":\"expectedVersion is required\"}"))
+		} else {
+			result.Status, result.ChangedFields, err = updateMainInfoRecord(APIstub, item.Identifier, strconv.FormatInt(*item.ExpectedVersion, 10), item.mainInfoPrivate())
+			if result.Status == "" {
+				return shim.Error(err.Error())
+			}
+			result.Error = batchItemError(err)
+		}
+		batch.add(result)
+	}
+
+	return batch.response(APIstub, mainInfoBatchUpdatedEvent)
+}
+
+//한 번에 처리할 수 있는 batch 항목 수를 정하는 함수
+// args: 최대 항목 수
+func (s *SmartContract) setMainInfoBatchLimit(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit <= 0 || limit > maxMainInfoBatchLimit {
+		return shim.Error(fmt.Sprintf("{\"Error\":\"batch limit must be between 1 and %d\"}", maxMainInfoBatchLimit))
+	}
+
+	limitKey, err := APIstub.CreateCompositeKey(mainInfoBatchLimitObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = APIstub.PutState(limitKey, []byte(strconv.Itoa(limit)))
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//JSON merge patch(RFC 7396)로 정보를 수정하는 함수
+//patch에 없는 필드는 그대로 두고, 문자열인 필드는 그 값으로 바꾸고, null인 필드는 지운다.
+//바꾼 뒤의 정보 전체를 다시 검사하므로 필수 필드를 지우면 검사 에러가 난다.
+// args: 식별자, 수정하기 전에 읽은 버전
+// transient: mainInfoPatch = {"name": "...", "salt": "...", ...}, mainInfoKey = 암호화 키
+func (s *SmartContract) patchMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	patch, err := getMainInfoPatchFromTransient(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mainInfo, mainInfoPrivate, key, _, err := getMainInfoForUpdate(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//patch를 합친 정보 전체를 검사해서 필수 필드가 비거나 규칙에 맞지 않는 값이 남지 않게 한다.
+	merged := mainInfoPrivate
+	fields := []struct {
+		name string
+		current string
+		merged *string
+	}{
+		{"name", mainInfoPrivate.Name, &merged.Name},
+		{"phone", mainInfoPrivate.Phone, &merged.Phone},
+		{"id", mainInfoPrivate.Id, &merged.Id},
+		{"salt", mainInfoPrivate.Salt, &merged.Salt},
+	}
+	for _, f := range fields {
+		*f.merged = patch.Apply(f.name, f.current)
+	}
+	err = validateMainInfoPrivate(APIstub, &merged, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//salt만 바뀌어도 해시가 바뀌므로 changedFields에 넣는다.
+	changedFields := []string{}
+	for _, f := range fields {
+		if *f.merged != f.current {
+			changedFields = append(changedFields, f.name)
+		}
+	}
+	mainInfoPrivate = merged
+
+	err = putMainInfo(APIstub, args[0], mainInfo, mainInfoPrivate, key, changedFields)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoUpdatedEvent, args[0], changedFields)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	changedAsBytes, _ := json.Marshal(changedFields)
+	return shim.Success(changedAsBytes)
+}
+
+//개인정보를 새 키로 다시 암호화하는 함수 (시점 조회용 사본도 같이 바꾼다)
+// args: 식별자, transient: mainInfoKey = 지금 키, mainInfoNewKey = 새 키
+func (s *SmartContract) rotateMainInfoKey(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	identifier := args[0]
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if mainInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + identifier + "\"}")
+	}
+
+	mainInfo := MainInfo{}
+	json.Unmarshal(mainInfoAsBytes, &mainInfo)
+
+	//소유자나 관리자만 키를 바꿀 수 있다.
+	err = checkMainInfoOwner(APIstub, identifier, mainInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	oldKey, err := getMainInfoKeyFromTransient(APIstub, mainInfoKeyTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	newKey, err := getMainInfoKeyFromTransient(APIstub, mainInfoNewKeyTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if oldKey == nil || newKey == nil {
+		return shim.Error("{\"Error\":\"" + mainInfoKeyTransientKey + " and " + mainInfoNewKeyTransientKey + " must be keys in the transient map\"}")
+	}
+
+	privateAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mainInfoPrivate := MainInfoPrivate{}
+	json.Unmarshal(privateAsBytes, &mainInfoPrivate)
+	if mainInfoPrivate.KeyFingerprint == "" {
+		return shim.Error("{\"Error\":\"record is not encrypted: " + identifier + "\"}")
+	}
+
+	err = openMainInfoPrivate(&mainInfoPrivate, identifier, oldKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//이전 사본을 먼저 바꾸고, 지금 값은 putMainInfo가 새 사본과 함께 저장한다.
+	err = rotateMainInfoRevisions(APIstub, identifier, oldKey, newKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putMainInfo(APIstub, identifier, mainInfo, mainInfoPrivate, newKey, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoKeyRotatedEvent, identifier, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//개인정보 검사 규칙을 바꾸는 함수
+// args: 규칙 json (validate.Rules)
+func (s *SmartContract) setValidationRules(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	var rules validate.Rules
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&rules)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to decode validation rules\"}")
+	}
+
+	err = rules.Check()
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid validation rules: " + err.Error() + "\"}")
+	}
+
+	rulesKey, err := APIstub.CreateCompositeKey(validationRulesObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rulesAsBytes, _ := json.Marshal(rules)
+	err = APIstub.PutState(rulesKey, rulesAsBytes)
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//개인정보 검사 규칙을 가져오는 함수 (클라이언트에서 입력을 미리 검사할 때 사용)
+func (s *SmartContract) getValidationRules(APIstub shim.ChaincodeStubInterface) sc.Response {
+	rules, err := getValidationRules(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rulesAsBytes, _ := json.Marshal(rules)
+	return shim.Success(rulesAsBytes)
+}
+
+//블라인드 인덱스 HMAC 키를 collection에 저장하는 함수 (한 번만 저장할 수 있다)
+// transient: blindIndexKey = 32바이트 키
+func (s *SmartContract) setBlindIndexKey(APIstub shim.ChaincodeStubInterface) sc.Response {
+	keyKey, err := APIstub.CreateCompositeKey(blindIndexKeyObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//키가 바뀌면 지금까지 만든 인덱스로 찾을 수 없으므로 덮어쓰지 않는다.
+	existing, err := APIstub.GetPrivateData(mainInfoCollection, keyKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if existing != nil {
+		return shim.Error("{\"Error\":\"blind index key is already set\"}")
+	}
+
+	key, err := getMainInfoKeyFromTransient(APIstub, blindIndexKeyTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if key == nil {
+		return shim.Error("{\"Error\":\"" + blindIndexKeyTransientKey + " must be a key in the transient map\"}")
+	}
+
+	err = APIstub.PutPrivateData(mainInfoCollection, keyKey, key)
+	if err != nil {
+		return shim.Error("Failed to put private data : " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//블라인드 인덱스가 없거나 예전 규칙(legacyBlindIndexValue)으로 만든 정보의 인덱스를 지금 규칙으로 다시 만드는 함수
+//검색용 값(normalized)이 없는 예전 정보도 이 함수로 채운다.
+//암호화하지 않은 예전 정보는 이 때 mainInfoKey로 암호화한다.
+// args: 식별자, transient: mainInfoKey = 암호화 키 (암호화한 정보면 그 키)
+func (s *SmartContract) reindexMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	privateAsBytes, err := getMainInfoPrivateData(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if privateAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + args[0] + "\"}")
+	}
+
+	mainInfoPrivate := MainInfoPrivate{}
+	json.Unmarshal(privateAsBytes, &mainInfoPrivate)
+
+	key, err := requireMainInfoKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = openMainInfoPrivate(&mainInfoPrivate, args[0], key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mainInfo := MainInfo{}
+	json.Unmarshal(mainInfoAsBytes, &mainInfo)
+
+	err = putMainInfo(APIstub, args[0], mainInfo, mainInfoPrivate, key, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//정보 하나를 검사해서 생성하는 함수 (createMainInfo와 createMainInfoBatch에서 쓴다)
+//항목의 문제로 만들지 못하면 batch 상태와 에러를, 원장을 읽고 쓰지 못하면 빈 상태와 에러를 돌려준다.
+func createMainInfoRecord(APIstub shim.ChaincodeStubInterface, identifier string, mainInfoPrivate MainInfoPrivate, retentionPurpose string, retainUntil string, key []byte) (string, error) {
+	if identifier == "" {
+		return batchStatusRejected, fmt.Errorf("{\"Error\":\"identifier must not be empty\"}")
+	}
+
+	//같은 식별자로 등록되어 있는것이 있는지 확인한다.
+	resultsAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return "", err
+	} else if resultsAsBytes != nil {
+		return batchStatusAlreadyExists, fmt.Errorf("Already exists!!!")
+	}
+
+	//migrateMainInfoKeys로 아직 옮기지 않은 예전 키도 확인한다.
+	resultsAsBytes, err = APIstub.GetState(identifier)
+	if err != nil {
+		return "", err
+	} else if resultsAsBytes != nil {
+		return batchStatusAlreadyExists, fmt.Errorf("Already exists!!!")
+	}
+
+	//파기한 식별자는 감사 기록이 섞이지 않도록 다시 쓰지 않는다.
+	tombstone, err := getMainInfoTombstone(APIstub, identifier)
+	if err != nil {
+		return "", err
+	} else if tombstone != nil {
+		return batchStatusRejected, fmt.Errorf("{\"Error\":\"identifier was erased and cannot be reused: %s\"}", identifier)
+	}
+
+	if mainInfoPrivate.Salt == "" {
+		return batchStatusValidationError, fmt.Errorf("{\"Error\":\"salt is required in transient mainInfo\"}")
+	}
+
+	//잘못된 필드는 모아서 한 번에 돌려준다.
+	err = validateMainInfoPrivate(APIstub, &mainInfoPrivate, false)
+	if _, ok := err.(validate.Errors); ok {
+		return batchStatusValidationError, err
+	} else if err != nil {
+		return "", err
+	}
+
+	//생성한 사람을 소유자로 기록한다.
+	ownerMSP, ownerSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return "", err
+	}
+
+	//목적이나 기한이 잘못됐으면 이 항목만 거절하고, 원장을 읽지 못하면 batch 전체를 멈춘다.
+	retentionPurpose, retainUntil, status, err := resolveRetainUntil(APIstub, retentionPurpose, retainUntil)
+	if err != nil {
+		return status, err
+	}
+
+	var mainInfo = MainInfo{OwnerMSP: ownerMSP, OwnerSubject: ownerSubject, RetentionPurpose: retentionPurpose, RetainUntil: retainUntil}
+	err = putMainInfo(APIstub, identifier, mainInfo, mainInfoPrivate, key, []string{"name", "phone", "id"})
+	if err != nil {
+		return "", err
+	}
+
+	err = putRetainUntilIndex(APIstub, identifier, retainUntil)
+	if err != nil {
+		return "", err
+	}
+
+	return batchStatusCreated, nil
+}
+
+//정보 하나를 검사해서 수정하는 함수 (updateMainInfo와 updateMainInfoBatch에서 쓴다)
+//update에서 빈 필드는 바꾸지 않는다. 돌려주는 상태는 createMainInfoRecord와 같다.
+func updateMainInfoRecord(APIstub shim.ChaincodeStubInterface, identifier string, expectedVersion string, update MainInfoPrivate) (string, []string, error) {
+	//소유자, 버전, 암호화 키가 맞지 않으면 수정하지 않고, 원장을 읽지 못하면 batch 전체를 멈춘다.
+	mainInfo, mainInfoPrivate, key, status, err := getMainInfoForUpdate(APIstub, identifier, expectedVersion)
+	if err != nil {
+		return status, nil, err
+	}
+
+	//바꾸려는 필드만 검사한다.
+	err = validateMainInfoPrivate(APIstub, &update, true)
+	if _, ok := err.(validate.Errors); ok {
+		return batchStatusValidationError, nil, err
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	changedFields := []string{}
+
+	if update.Name != "" && update.Name != mainInfoPrivate.Name {
+		mainInfoPrivate.Name = update.Name
+		changedFields = append(changedFields, "name")
+	}
+
+	if update.Phone != "" && update.Phone != mainInfoPrivate.Phone {
+		mainInfoPrivate.Phone = update.Phone
+		changedFields = append(changedFields, "phone")
+	}
+
+	if update.Id != "" && update.Id != mainInfoPrivate.Id {
+		mainInfoPrivate.Id = update.Id
+		changedFields = append(changedFields, "id")
+	}
+
+	if update.Salt != "" {
+		mainInfoPrivate.Salt = update.Salt
+	}
+
+	err = putMainInfo(APIstub, identifier, mainInfo, mainInfoPrivate, key, changedFields)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return batchStatusUpdated, changedFields, nil
+}
+
+//transient map에서 batch 항목을 꺼내는 함수 (항목 수가 저장된 한도를 넘으면 전체를 거절한다)
+func getMainInfoBatchFromTransient(APIstub shim.ChaincodeStubInterface) ([]MainInfoBatchItem, error) {
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	batchAsBytes, ok := transientMap[mainInfoBatchTransientKey]
+	if !ok {
+		return nil, fmt.Errorf("{\"Error\":\"%s must be a key in the transient map\"}", mainInfoBatchTransientKey)
+	}
+
+	var items []MainInfoBatchItem
+	decoder := json.NewDecoder(bytes.NewReader(batchAsBytes))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&items)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"%s must be a JSON array of items\"}", mainInfoBatchTransientKey)
+	}
+
+	limit, err := getMainInfoBatchLimit(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 || len(items) > limit {
+		return nil, fmt.Errorf("{\"Error\":\"batch must have 1 to %d items\"}", limit)
+	}
+
+	return items, nil
+}
+
+//저장된 batch 항목 수 한도를 가져오는 함수 (없으면 기본값)
+func getMainInfoBatchLimit(APIstub shim.ChaincodeStubInterface) (int, error) {
+	limitKey, err := APIstub.CreateCompositeKey(mainInfoBatchLimitObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+
+	limitAsBytes, err := APIstub.GetState(limitKey)
+	if err != nil {
+		return 0, err
+	} else if limitAsBytes == nil {
+		return defaultMainInfoBatchLimit, nil
+	}
+
+	limit, err := strconv.Atoi(string(limitAsBytes))
+	if err != nil {
+		return 0, fmt.Errorf("{\"Error\":\"Failed to decode batch limit\"}")
+	}
+
+	return limit, nil
+}
+
+//항목 에러를 결과에 넣을 json으로 바꾸는 함수 (json이 아닌 에러는 {"Error": ...}로 감싼다)
+func batchItemError(err error) json.RawMessage {
+	if err == nil {
+		return nil
+	}
+	if json.Valid([]byte(err.Error())) {
+		return json.RawMessage(err.Error())
+	}
+	errorAsBytes, _ := json.Marshal(map[string]string{"Error": err.Error()})
+	return errorAsBytes
+}
+
+//batch 결과를 모으는 값
+type mainInfoBatchResult struct {
+	MainInfoBatchResult
+	seen map[string]bool
+	//이벤트에 넣을 성공한 식별자
+	applied []string
+}
+
+func newMainInfoBatchResult(size int) *mainInfoBatchResult {
+	return &mainInfoBatchResult{
+		MainInfoBatchResult: MainInfoBatchResult{Results: make([]MainInfoBatchItemResult, 0, size), Counts: map[string]int{}},
+		seen: map[string]bool{},
+	}
+}
+
+func (b *mainInfoBatchResult) add(result MainInfoBatchItemResult) {
+	b.Results = append(b.Results, result)
+	b.Counts[result.Status]++
+	//실패한 항목은 아무것도 쓰지 않았으므로 같은 식별자를 뒤에서 다시 처리할 수 있다.
+	if result.Status == batchStatusCreated || result.Status == batchStatusUpdated {
+		b.seen[result.Identifier] = true
+		b.applied = append(b.applied, result.Identifier)
+	}
+}
+
+//성공한 식별자를 요약 이벤트 하나로 남기고 항목별 결과를 돌려주는 함수
+func (b *mainInfoBatchResult) response(APIstub shim.ChaincodeStubInterface, eventType string) sc.Response {
+	if len(b.applied) > 0 {
+		actorMSP, err := cid.GetMSPID(APIstub)
+		if err != nil {
+			return shim.Error("Failed to get creator MSP ID: " + err.Error())
+		}
+
+		txTime, err := getTxTime(APIstub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		event := MainInfoBatchEvent{
+			EventType: eventType,
+			Identifiers: b.applied,
+			ActorMSP: actorMSP,
+			Timestamp: txTime.Format(time.RFC3339Nano),
+		}
+		eventAsBytes, _ := json.Marshal(event)
+		err = APIstub.SetEvent(eventType, eventAsBytes)
+		if err != nil {
+			return shim.Error("Failed to set event: " + err.Error())
+		}
+	}
+
+	resultAsBytes, _ := json.Marshal(b.MainInfoBatchResult)
+	return shim.Success(resultAsBytes)
+}
+
+//수정할 정보를 가져오는 함수 (소유자와 버전을 확인하고, 암호화한 정보는 복호화해서 돌려준다)
+//소유자, 버전, 암호화 키가 맞지 않으면 batch 상태와 에러를, 원장을 읽지 못하면 빈 상태와 에러를 돌려준다.
+func getMainInfoForUpdate(APIstub shim.ChaincodeStubInterface, identifier string, expectedVersionArg string) (MainInfo, MainInfoPrivate, []byte, string, error) {
+	mainInfo := MainInfo{}
+	mainInfoPrivate := MainInfoPrivate{}
+
+	expectedVersion, err := strconv.ParseInt(expectedVersionArg, 10, 64)
+	if err != nil || expectedVersion < 0 {
+		return mainInfo, mainInfoPrivate, nil, batchStatusRejected, fmt.Errorf("{\"Error\":\"expected version must be a non-negative number\"}")
+	}
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, "", err
+	} else if mainInfoAsBytes == nil {
+		return mainInfo, mainInfoPrivate, nil, batchStatusNotFound, fmt.Errorf("Info does not exist")
+	}
+	err = json.Unmarshal(mainInfoAsBytes, &mainInfo)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, "", fmt.Errorf("{\"Error\":\"Failed to decode JSON of: %s\"}", identifier)
+	}
+
+	//소유자나 관리자만 수정할 수 있다.
+	err = checkMainInfoOwner(APIstub, identifier, mainInfo)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, batchStatusRejected, err
+	}
+
+	//다른 사람이 먼저 수정했으면 덮어쓰지 않는다.
+	err = checkMainInfoVersion(identifier, mainInfo, expectedVersion)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, batchStatusRejected, err
+	}
+
+	privateAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, "", err
+	} else if privateAsBytes == nil {
+		return mainInfo, mainInfoPrivate, nil, "", fmt.Errorf("{\"Error\":\"Private data does not exist for: %s\"}", identifier)
+	}
+	err = json.Unmarshal(privateAsBytes, &mainInfoPrivate)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, "", fmt.Errorf("{\"Error\":\"Failed to decode private JSON of: %s\"}", identifier)
+	}
+
+	//수정한 값은 항상 암호화해서 저장하므로 키가 있어야 한다. (암호화하지 않은 예전 정보는 이 때 암호화된다)
+	key, err := requireMainInfoKey(APIstub)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, batchStatusRejected, err
+	}
+
+	//암호화된 정보는 같은 키로 풀어야 비교하고 다시 암호화할 수 있다.
+	err = openMainInfoPrivate(&mainInfoPrivate, identifier, key)
+	if err != nil {
+		return mainInfo, mainInfoPrivate, nil, batchStatusRejected, err
+	}
+
+	return mainInfo, mainInfoPrivate, key, "", nil
+}
+
+//정보를 삭제하는 함수
+func (s *SmartContract) deleteMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response{
+	var jsonResp string
+	var mainInfoJSON MainInfo
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	identifier := args[0]
+
+	valAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + identifier + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsBytes == nil {
+		jsonResp = "{\"Error\":\"identifier does not exist: " + identifier + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	err = json.Unmarshal([]byte(valAsBytes), &mainInfoJSON)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	//소유자나 관리자만 삭제할 수 있다.
+	err = checkMainInfoOwner(APIstub, identifier, mainInfoJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = deleteMainInfoRecord(APIstub, identifier, mainInfoJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoDeletedEvent, identifier, []string{"name", "phone", "id"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//개인정보를 파기하는 함수
+//현재 값과 시점 조회용 사본을 collection에서 모두 지우고, 공개 원장에는 파기 기록만 남긴다.
+//공개 원장의 이력에는 솔트를 넣은 해시만 있고 솔트도 함께 지워지므로 해시로는 개인정보를 되살릴 수 없다.
+//collection의 blockToLive가 0이라 예전 블록의 private write-set은 peer에 계속 남는다.
+//그래서 정보는 항상 mainInfoKey로 암호화해서 저장하고, 파기한 뒤 원장 밖에서 그 키를 지워야 파기가 끝난다. (파기 기록의 keyFingerprint)
+//체인코드는 키를 지웠는지 확인할 수 없으므로 파기 기록은 지워야 할 키만 알려준다.
+//암호화가 필수가 되기 전에 평문으로 저장된 값은 예전 write-set으로 collection 멤버 peer에 남는다. (파기 기록의 plaintextKeys)
+//블라인드 인덱스 키(field~HMAC~식별자)는 공개 원장의 키 이름이라 지워도 블록 이력에 남는다.
+//블라인드 인덱스 키를 아는 collection 멤버는 값을 추측해서 식별자와 맞춰볼 수 있다.
+// args: 식별자, 파기 사유
+func (s *SmartContract) eraseMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	identifier := args[0]
+
+	mainInfoAsBytes, err := getMainInfoState(APIstub, identifier)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + identifier + "\"}")
+	} else if mainInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + identifier + "\"}")
+	}
+
+	var mainInfo MainInfo
+	err = json.Unmarshal(mainInfoAsBytes, &mainInfo)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}")
+	}
+
+	//정보 주체 본인은 checkFunctionAccess에서 확인했고, 그 외에는 소유자나 관리자만 파기할 수 있다.
+	if cid.AssertAttributeValue(APIstub, roleAttribute, subjectRole) != nil {
+		err = checkMainInfoOwner(APIstub, identifier, mainInfo)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	tombstone, err := eraseMainInfoRecord(APIstub, identifier, mainInfo, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMainInfoEvent(APIstub, mainInfoErasedEvent, identifier, []string{"name", "phone", "id"})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	tombstoneAsBytes, _ := json.Marshal(tombstone)
+	return shim.Success(tombstoneAsBytes)
+}
+
+//식별자의 파기 기록을 가져오는 함수
+func (s *SmartContract) getMainInfoTombstone(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	tombstone, err := getMainInfoTombstone(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if tombstone == nil {
+		return shim.Error("{\"Error\":\"identifier was not erased: " + args[0] + "\"}")
+	}
+
+	tombstoneAsBytes, _ := json.Marshal(tombstone)
+	return shim.Success(tombstoneAsBytes)
+}
+
+//식별자를 그대로 키로 써서 저장한 예전 정보를 MainInfo composite key로 옮기는 함수 (업그레이드 후 한 번)
+//composite key는 범위 조회에 걸리지 않으므로 GetStateByRange로는 옮기지 않은 예전 키만 나온다.
+//예전 키의 이력은 지우지 않으므로 getHistoryMainInfo, getMainInfoAsOf는 두 키의 이력을 이어서 본다.
+//MainInfo로 읽히지 않는 값(해시가 없거나 모르는 필드가 있는 값)은 옮기지 않고 skippedKeys로 돌려준다.
+//건너뛴 키는 그대로 남으므로 hasMore면 lastKey를 startAfter로 넘겨 이어서 옮긴다.
+// args: 최대 개수(읽는 키 수), startAfter(선택, 이 키 뒤부터)
+func (s *SmartContract) migrateMainInfoKeys(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+
+	batchSize, err := strconv.Atoi(args[0])
+	if err != nil || batchSize <= 0 || batchSize > maxMigrationBatchSize {
+		return shim.Error(fmt.Sprintf("{\"Error\":\"batch size must be between 1 and %d\"}", maxMigrationBatchSize))
+	}
+
+	//startAfter 바로 뒤의 키부터 읽는다.
+	startKey := ""
+	if len(args) == 2 && args[1] != "" {
+		startKey = args[1] + "\x00"
+	}
+
+	resultsIterator, err := APIstub.GetStateByRange(startKey, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	//남은 정보가 있는지 알 수 있도록 하나 더 읽고, iterator를 다 읽은 다음에 옮긴다.
+	records := []QueryRecord{}
+	for resultsIterator.HasNext() && len(records) <= batchSize {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		records = append(records, QueryRecord{Key: queryResponse.Key, Record: queryResponse.Value})
+	}
+
+	migration := MainInfoKeyMigration{Identifiers: []string{}, SkippedKeys: []string{}, HasMore: len(records) > batchSize}
+	for i, record := range records {
+		if i == batchSize {
+			break
+		}
+		identifier := record.Key
+		migration.LastKey = identifier
+
+		if !isMainInfoValue(record.Record) {
+			migration.SkippedKeys = append(migration.SkippedKeys, identifier)
+			continue
+		}
+
+		existing, err := getMainInfoState(APIstub, identifier)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if existing != nil {
+			return shim.Error("{\"Error\":\"identifier already exists under the new key: " + identifier + "\"}")
+		}
+
+		err = putMainInfoState(APIstub, identifier, record.Record)
+		if err != nil {
+			return shim.Error("Failed to put state : " + err.Error())
+		}
+		err = APIstub.DelState(identifier)
+		if err != nil {
+			return shim.Error("Failed to delete state : " + err.Error())
+		}
+
+		privateAsBytes, err := APIstub.GetPrivateData(mainInfoCollection, identifier)
+		if err != nil {
+			return shim.Error("Failed to get private data : " + err.Error())
+		}
+		if privateAsBytes != nil {
+			err = putMainInfoPrivateData(APIstub, identifier, privateAsBytes)
+			if err != nil {
+				return shim.Error("Failed to put private data : " + err.Error())
+			}
+			err = APIstub.DelPrivateData(mainInfoCollection, identifier)
+			if err != nil {
+				return shim.Error("Failed to delete private data : " + err.Error())
+			}
+		}
+
+		migration.Identifiers = append(migration.Identifiers, identifier)
+	}
+	migration.MigratedCount = len(migration.Identifiers)
+
+	migrationAsBytes, _ := json.Marshal(migration)
+	return shim.Success(migrationAsBytes)
+}
+
+//원장 값이 MainInfo인지 확인하는 함수 (모르는 필드가 있거나 해시가 없으면 MainInfo가 아니다)
+func isMainInfoValue(value []byte) bool {
+	var mainInfo MainInfo
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(&mainInfo) != nil || decoder.More() {
+		return false
+	}
+	return mainInfo.Hash != ""
+}
+
+//이용 목적별 보유 기간을 정하는 함수 (이미 저장한 정보의 기한은 바뀌지 않는다)
+// args: 이용 목적, 보유 기간(일)
+func (s *SmartContract) setRetentionPolicy(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	if args[0] == "" {
+		return shim.Error("{\"Error\":\"purpose must not be empty\"}")
+	}
+
+	retentionDays, err := strconv.Atoi(args[1])
+	if err != nil || retentionDays <= 0 {
+		return shim.Error("{\"Error\":\"retention days must be a positive number\"}")
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	updatedByMSP, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get creator MSP ID: " + err.Error())
+	}
+
+	policy := RetentionPolicy{
+		Purpose: args[0],
+		RetentionDays: retentionDays,
+		UpdatedAt: txTime.Format(time.RFC3339Nano),
+		UpdatedByMSP: updatedByMSP,
+	}
+
+	policyKey, err := APIstub.CreateCompositeKey(retentionPolicyObjectType, []string{policy.Purpose})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policyAsBytes, _ := json.Marshal(policy)
+	err = APIstub.PutState(policyKey, policyAsBytes)
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	return shim.Success(policyAsBytes)
+}
+
+//보유 기간 정책 목록을 가져오는 함수
+func (s *SmartContract) getRetentionPolicies(APIstub shim.ChaincodeStubInterface) sc.Response {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(retentionPolicyObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	policies := []RetentionPolicy{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var policy RetentionPolicy
+		err = json.Unmarshal(queryResponse.Value, &policy)
+		if err != nil {
+			return shim.Error("{\"Error\":\"Failed to decode retention policy\"}")
+		}
+		policies = append(policies, policy)
+	}
+
+	policiesAsBytes, _ := json.Marshal(policies)
+	return shim.Success(policiesAsBytes)
+}
+
+//보유 기한이 지난 정보를 페이지 단위로 가져오는 함수 (공개 원장만 보므로 개인정보는 없다)
+// args: 기준 시각(RFC3339, 빈 값이면 지금), 페이지 크기, bookmark(처음엔 빈 값)
+func (s *SmartContract) queryExpiredMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	asOf, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[0] != "" {
+		asOf, err = time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			return shim.Error("{\"Error\":\"asOf must be an RFC3339 timestamp\"}")
+		}
+	}
+
+	pageSize, err := parsePageSize(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	query, err := buildExpiredMainInfoQuery(asOf)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, metadata, err := APIstub.GetQueryResultWithPagination(query, pageSize, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records, _, err := collectQueryRecords(APIstub, resultsIterator, pageSize, nil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pageAsBytes, _ := json.Marshal(MainInfoPage{Records: records, Bookmark: metadata.Bookmark, FetchedCount: metadata.FetchedRecordsCount})
+	return shim.Success(pageAsBytes)
+}
+
+//보유 기한이 지난 정보를 정해진 개수만큼 지우는 함수 (남은 정보가 있으면 hasMore가 true)
+//delete는 정보와 사본을 지우고, erase는 eraseMainInfo처럼 동의를 철회하고 파기 기록도 남긴다.
+//rich query는 commit할 때 다시 검증되지 않으므로 보유 기한 인덱스(MainInfoRetainUntil~기한~식별자)를 기한 순서로 읽고,
+//지우기 전에 정보를 다시 읽어서 기한을 확인한다.
+//읽은 인덱스는 정보와 함께 지우거나 (기한이 다르면) 인덱스만 지우므로, 다음 호출은 앞에서 건너뛸 것 없이 남은 첫 키부터 읽는다.
+//(invoke에서는 composite key 범위를 페이지로 나눠 읽을 수 없어서 지워진 키가 곧 이어 읽을 위치가 된다)
+//트랜잭션 하나에 이벤트는 하나만 남으므로 지운 식별자를 모아 요약 이벤트 하나로 보낸다.
+// args: 방법(delete, erase), 최대 개수
+func (s *SmartContract) purgeExpiredMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	mode := args[0]
+	if mode != purgeModeDelete && mode != purgeModeErase {
+		return shim.Error("{\"Error\":\"mode must be " + purgeModeDelete + " or " + purgeModeErase + "\"}")
+	}
+
+	batchSize, err := strconv.Atoi(args[1])
+	if err != nil || batchSize <= 0 || batchSize > maxPurgeBatchSize {
+		return shim.Error(fmt.Sprintf("{\"Error\":\"batch size must be between 1 and %d\"}", maxPurgeBatchSize))
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	asOf := txTime.Format(time.RFC3339)
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(mainInfoRetainUntilObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	//기한 순서로 정렬되어 있으므로 기한이 asOf보다 뒤인 키가 나오면 멈춘다. (batchSize+1개를 넘게 읽지 않는다)
+	//남은 정보가 있는지 알 수 있도록 하나 더 읽고, iterator를 다 읽은 다음에 지운다.
+	type expiredIndex struct {
+		identifier string
+		retainUntil string
+	}
+	expired := []expiredIndex{}
+	for resultsIterator.HasNext() && len(expired) <= batchSize {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if keyParts[0] > asOf {
+			break
+		}
+		expired = append(expired, expiredIndex{identifier: keyParts[1], retainUntil: keyParts[0]})
+	}
+
+	actorMSP, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get creator MSP ID: " + err.Error())
+	}
+
+	summary := MainInfoPurgeSummary{
+		EventType: mainInfoExpiredPurgedEvent,
+		Mode: mode,
+		AsOf: asOf,
+		Identifiers: []string{},
+		HasMore: len(expired) > batchSize,
+		ActorMSP: actorMSP,
+		Timestamp: txTime.Format(time.RFC3339Nano),
+	}
+
+	for i, index := range expired {
+		if i == batchSize {
+			break
+		}
+
+		//GetState로 다시 읽어서 read set에 넣는다. (그 사이 바뀌면 commit할 때 MVCC 검증에서 걸린다)
+		mainInfoAsBytes, err := getMainInfoState(APIstub, index.identifier)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var mainInfo MainInfo
+		if mainInfoAsBytes != nil {
+			err = json.Unmarshal(mainInfoAsBytes, &mainInfo)
+			if err != nil {
+				return shim.Error("{\"Error\":\"Failed to decode JSON of: " + index.identifier + "\"}")
+			}
+		}
+
+		//정보가 없거나 기한이 인덱스와 다르면 남은 인덱스만 지운다.
+		if mainInfoAsBytes == nil || mainInfo.RetainUntil != index.retainUntil {
+			err = delRetainUntilIndex(APIstub, index.identifier, index.retainUntil)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
+		}
+
+		if mode == purgeModeErase {
+			_, err = eraseMainInfoRecord(APIstub, index.identifier, mainInfo, "retention period expired")
+		} else {
+			//시점 조회용 사본도 기한이 지났으므로 같이 지운다.
+			err = deleteMainInfoRecord(APIstub, index.identifier, mainInfo)
+			if err == nil {
+				_, _, err = purgeMainInfoPrivate(APIstub, index.identifier)
+			}
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		summary.Identifiers = append(summary.Identifiers, index.identifier)
+	}
+	summary.PurgedCount = len(summary.Identifiers)
+
+	summaryAsBytes, _ := json.Marshal(summary)
+	err = APIstub.SetEvent(mainInfoExpiredPurgedEvent, summaryAsBytes)
+	if err != nil {
+		return shim.Error("Failed to set event: " + err.Error())
+	}
+
+	return shim.Success(summaryAsBytes)
+}
+
+//정보가 바뀌었다는 이벤트를 남기는 함수 (트랜잭션 하나에 이벤트는 하나만 남는다)
+func setMainInfoEvent(APIstub shim.ChaincodeStubInterface, eventType string, identifier string, changedFields []string) error {
+	actorMSP, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return fmt.Errorf("Failed to get creator MSP ID: %s", err.Error())
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return err
+	}
+
+	event := MainInfoEvent{
+		EventType: eventType,
+		Identifier: identifier,
+		ChangedFields: changedFields,
+		ActorMSP: actorMSP,
+		Timestamp: txTime.Format(time.RFC3339Nano),
+	}
+	eventAsBytes, _ := json.Marshal(event)
+
+	err = APIstub.SetEvent(eventType, eventAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to set event: %s", err.Error())
+	}
+
+	return nil
+}
+
+//transient map에서 개인정보를 꺼내는 함수
+func getMainInfoFromTransient(APIstub shim.ChaincodeStubInterface) (MainInfoPrivate, error) {
+	var mainInfoPrivate MainInfoPrivate
+
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return mainInfoPrivate, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	mainInfoAsBytes, ok := transientMap[mainInfoTransientKey]
+	if !ok {
+		return mainInfoPrivate, fmt.Errorf("{\"Error\":\"%s must be a key in the transient map\"}", mainInfoTransientKey)
+	}
+
+	err = json.Unmarshal(mainInfoAsBytes, &mainInfoPrivate)
+	if err != nil {
+		return mainInfoPrivate, fmt.Errorf("{\"Error\":\"Failed to decode transient %s\"}", mainInfoTransientKey)
+	}
+
+	return mainInfoPrivate, nil
+}
+
+//저장된 검사 규칙을 가져오는 함수 (없으면 기본 규칙)
+func getValidationRules(APIstub shim.ChaincodeStubInterface) (validate.Rules, error) {
+	rulesKey, err := APIstub.CreateCompositeKey(validationRulesObjectType, []string{})
+	if err != nil {
+		return validate.DefaultRules, err
+	}
+
+	rulesAsBytes, err := APIstub.GetState(rulesKey)
+	if err != nil {
+		return validate.DefaultRules, err
+	} else if rulesAsBytes == nil {
+		return validate.DefaultRules, nil
+	}
+
+	var rules validate.Rules
+	err = json.Unmarshal(rulesAsBytes, &rules)
+	if err != nil {
+		return validate.DefaultRules, fmt.Errorf("{\"Error\":\"Failed to decode validation rules\"}")
+	}
+
+	return rules, nil
+}
+
+//name, phone, id를 검사하고 정리한 값(앞뒤 공백 제거, 전화번호는 E.164)으로 바꾸는 함수
+//partial이면 빈 필드는 바꾸지 않는 것으로 보고 검사하지 않는다.
+func validateMainInfoPrivate(APIstub shim.ChaincodeStubInterface, mainInfoPrivate *MainInfoPrivate, partial bool) error {
+	rules, err := getValidationRules(APIstub)
+	if err != nil {
+		return err
+	}
+	compiled, err := rules.Compile()
+	if err != nil {
+		return fmt.Errorf("{\"Error\":\"Invalid validation rules: %s\"}", err.Error())
+	}
+
+	fieldErrors := validate.Errors{}
+	checks := []struct {
+		value *string
+		check func(string) (string, *validate.FieldError)
+	}{
+		{&mainInfoPrivate.Name, compiled.Name},
+		{&mainInfoPrivate.Phone, compiled.Phone},
+		{&mainInfoPrivate.Id, compiled.Id},
+	}
+	//솔트는 검사 규칙이 없지만 해시에 꼭 필요하므로 전체 검사에서는 비어 있으면 안 된다.
+	if !partial && mainInfoPrivate.Salt == "" {
+		fieldErrors = append(fieldErrors, validate.FieldError{Field: "salt", Message: "is required"})
+	}
+	for _, c := range checks {
+		if partial && *c.value == "" {
+			continue
+		}
+		value, fieldError := c.check(*c.value)
+		if fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+			continue
+		}
+		*c.value = value
+	}
+
+	if len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+//transient map에서 merge patch를 꺼내서 검사하는 함수
+//필드 값은 문자열이나 null(지우기)이어야 한다. 지운 필드가 필수인지는 patch를 합친 뒤에 검사한다.
+func getMainInfoPatchFromTransient(APIstub shim.ChaincodeStubInterface) (validate.Patch, error) {
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	patchAsBytes, ok := transientMap[mainInfoPatchTransientKey]
+	if !ok {
+		return nil, fmt.Errorf("{\"Error\":\"%s must be a key in the transient map\"}", mainInfoPatchTransientKey)
+	}
+
+	patch, err := validate.DecodePatch(patchAsBytes, patchableFields)
+	if _, ok := err.(validate.Errors); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"%s must be a JSON object\"}", mainInfoPatchTransientKey)
+	}
+
+	return patch, nil
+}
+
+//transient map에서 개인정보를 저장할 암호화 키를 꺼내는 함수 (없으면 에러)
+func requireMainInfoKey(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	key, err := getMainInfoKeyFromTransient(APIstub, mainInfoKeyTransientKey)
+	if err != nil {
+		return nil, err
+	} else if key == nil {
+		return nil, fmt.Errorf("{\"Error\":\"%s is required in the transient map\"}", mainInfoKeyTransientKey)
+	}
+	return key, nil
+}
+
+//transient map에서 암호화 키를 꺼내는 함수 (없으면 nil)
+func getMainInfoKeyFromTransient(APIstub shim.ChaincodeStubInterface, transientKey string) ([]byte, error) {
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	key, ok := transientMap[transientKey]
+	if !ok {
+		return nil, nil
+	}
+
+	err = fieldcrypt.CheckKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"transient %s: %s\"}", transientKey, err.Error())
+	}
+
+	return key, nil
+}
+
+//name, phone, id를 암호화한 사본을 돌려주는 함수
+//nonceSeed는 같은 키로 같은 nonce가 다시 나오지 않게 하는 값이다. (트랜잭션 ID 등)
+func sealMainInfoPrivate(mainInfoPrivate MainInfoPrivate, identifier string, key []byte, nonceSeed ...string) (MainInfoPrivate, error) {
+	fields := []*string{&mainInfoPrivate.Name, &mainInfoPrivate.Phone, &mainInfoPrivate.Id}
+	for i, name := range []string{"name", "phone", "id"} {
+		sealed, err := fieldcrypt.Seal(key, *fields[i], identifier+"\x00"+name, append([]string{identifier, name}, nonceSeed...)...)
+		if err != nil {
+			return mainInfoPrivate, fmt.Errorf("{\"Error\":\"Failed to encrypt %s: %s\"}", name, err.Error())
+		}
+		*fields[i] = sealed
+	}
+	mainInfoPrivate.KeyFingerprint = fieldcrypt.Fingerprint(key)
+	//검색용 값이 평문으로 남지 않게 한다. (암호화한 정보는 블라인드 인덱스로만 찾는다)
+	mainInfoPrivate.Normalized = nil
+	return mainInfoPrivate, nil
+}
+
+//암호화된 name, phone, id를 복호화하는 함수 (암호화하지 않은 정보는 그대로 둔다)
+func openMainInfoPrivate(mainInfoPrivate *MainInfoPrivate, identifier string, key []byte) error {
+	if mainInfoPrivate.KeyFingerprint == "" {
+		return nil
+	}
+	if mainInfoPrivate.KeyFingerprint != fieldcrypt.Fingerprint(key) {
+		return fmt.Errorf("{\"Error\":\"%s does not match the key of: %s\"}", mainInfoKeyTransientKey, identifier)
+	}
+
+	fields := []*string{&mainInfoPrivate.Name, &mainInfoPrivate.Phone, &mainInfoPrivate.Id}
+	for i, name := range []string{"name", "phone", "id"} {
+		plaintext, err := fieldcrypt.Open(key, *fields[i], identifier+"\x00"+name)
+		if err != nil {
+			return fmt.Errorf("{\"Error\":\"Failed to decrypt %s of: %s\"}", name, identifier)
+		}
+		*fields[i] = plaintext
+	}
+	mainInfoPrivate.KeyFingerprint = ""
+	return nil
+}
+
+//조회할 때 키가 맞는 정보만 복호화하는 함수 (키가 없거나 다르면 암호문을 그대로 돌려준다)
+func openMainInfoForRead(mainInfoPrivate *MainInfoPrivate, identifier string, key []byte) error {
+	if key == nil || mainInfoPrivate.KeyFingerprint != fieldcrypt.Fingerprint(key) {
+		return nil
+	}
+	return openMainInfoPrivate(mainInfoPrivate, identifier, key)
+}
+
+//식별자의 시점 조회용 사본 중 oldKey로 암호화한 것을 newKey로 다시 암호화하는 함수
+func rotateMainInfoRevisions(APIstub shim.ChaincodeStubInterface, identifier string, oldKey []byte, newKey []byte) error {
+	resultsIterator, err := APIstub.GetPrivateDataByPartialCompositeKey(mainInfoCollection, mainInfoRevisionObjectType, []string{identifier})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	oldFingerprint := fieldcrypt.Fingerprint(oldKey)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		var revision MainInfoRevision
+		err = json.Unmarshal(queryResponse.Value, &revision)
+		if err != nil {
+			return fmt.Errorf("{\"Error\":\"Failed to decode revision of: %s\"}", identifier)
+		}
+		if revision.Info.KeyFingerprint != oldFingerprint {
+			continue
+		}
+
+		err = openMainInfoPrivate(&revision.Info, identifier, oldKey)
+		if err != nil {
+			return err
+		}
+		revision.Info, err = sealMainInfoPrivate(revision.Info, identifier, newKey, APIstub.GetTxID(), revision.TxId)
+		if err != nil {
+			return err
+		}
+
+		revisionAsBytes, _ := json.Marshal(revision)
+		err = APIstub.PutPrivateData(mainInfoCollection, queryResponse.Key, revisionAsBytes)
+		if err != nil {
+			return fmt.Errorf("Failed to put private data: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+//개인정보는 collection에, 솔트를 넣은 해시는 공개 원장에 저장하는 함수
+//name, phone, id는 key로 암호화해서 저장한다.
+func putMainInfo(APIstub shim.ChaincodeStubInterface, identifier string, mainInfo MainInfo, mainInfoPrivate MainInfoPrivate, key []byte, changedFields []string) error {
+	//암호화하기 전의 값으로 블라인드 인덱스를 만든다.
+	blindIndexes, err := putBlindIndexes(APIstub, identifier, mainInfoPrivate)
+	if err != nil {
+		return err
+	}
+	mainInfoPrivate.BlindIndexes = blindIndexes
+	mainInfoPrivate.Normalized = &MainInfoNormalized{
+		Name: validate.Normalize("name", mainInfoPrivate.Name),
+		Phone: validate.Normalize("phone", mainInfoPrivate.Phone),
+		Id: validate.Normalize("id", mainInfoPrivate.Id),
+	}
+
+	if key == nil {
+		return fmt.Errorf("{\"Error\":\"%s is required to store: %s\"}", mainInfoKeyTransientKey, identifier)
+	}
+	mainInfoPrivate, err = sealMainInfoPrivate(mainInfoPrivate, identifier, key, APIstub.GetTxID())
+	if err != nil {
+		return err
+	}
+
+	privateAsBytes, _ := json.Marshal(mainInfoPrivate)
+	err = putMainInfoPrivateData(APIstub, identifier, privateAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put private data: %s", err.Error())
+	}
+
+	//시점 조회를 위해 이 트랜잭션의 사본도 남긴다.
+	revisionKey, err := APIstub.CreateCompositeKey(mainInfoRevisionObjectType, []string{identifier, APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	revisionAsBytes, _ := json.Marshal(MainInfoRevision{TxId: APIstub.GetTxID(), Info: mainInfoPrivate})
+	err = APIstub.PutPrivateData(mainInfoCollection, revisionKey, revisionAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put private data: %s", err.Error())
+	}
+
+	//솔트가 개인정보와 함께 들어가므로 해시만으로는 개인정보를 추측할 수 없다.
+	hash := sha256.Sum256(privateAsBytes)
+	mainInfo.Hash = hex.EncodeToString(hash[:])
+
+	mainInfo.ModifiedByMSP, mainInfo.ModifiedBySubject, err = getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return err
+	}
+	mainInfo.Version++
+	mainInfo.UpdatedAt = txTime.Format(time.RFC3339Nano)
+	//이력에서 어떤 필드가 바뀌었는지 볼 수 있도록 필드 이름만 남긴다.
+	mainInfo.ChangedFields = changedFields
+
+	mainInfoAsBytes, _ := json.Marshal(mainInfo)
+	err = putMainInfoState(APIstub, identifier, mainInfoAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put state: %s", err.Error())
+	}
+
+	return nil
+}
+
+//MainInfo의 composite key를 만드는 함수
+func mainInfoKey(APIstub shim.ChaincodeStubInterface, identifier string) (string, error) {
+	return APIstub.CreateCompositeKey(mainInfoObjectType, []string{identifier})
+}
+
+//쿼리 결과의 키에서 식별자를 꺼내는 함수 (MainInfo composite key가 아니면 키를 그대로 돌려준다)
+func identifierFromKey(APIstub shim.ChaincodeStubInterface, key string) (string, error) {
+	if !strings.HasPrefix(key, "\x00") {
+		return key, nil
+	}
+
+	objectType, attributes, err := APIstub.SplitCompositeKey(key)
+	if err != nil {
+		return "", err
+	}
+	if objectType != mainInfoObjectType || len(attributes) != 1 {
+		return key, nil
+	}
+	return attributes[0], nil
+}
+
+//공개 원장에서 식별자의 MainInfo를 가져오는 함수
+func getMainInfoState(APIstub shim.ChaincodeStubInterface, identifier string) ([]byte, error) {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return nil, err
+	}
+	return APIstub.GetState(key)
+}
+
+func putMainInfoState(APIstub shim.ChaincodeStubInterface, identifier string, value []byte) error {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, value)
+}
+
+func delMainInfoState(APIstub shim.ChaincodeStubInterface, identifier string) error {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+	return APIstub.DelState(key)
+}
+
+//collection에서 식별자의 개인정보를 가져오는 함수
+func getMainInfoPrivateData(APIstub shim.ChaincodeStubInterface, identifier string) ([]byte, error) {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return nil, err
+	}
+	return APIstub.GetPrivateData(mainInfoCollection, key)
+}
+
+func putMainInfoPrivateData(APIstub shim.ChaincodeStubInterface, identifier string, value []byte) error {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutPrivateData(mainInfoCollection, key, value)
+}
+
+func delMainInfoPrivateData(APIstub shim.ChaincodeStubInterface, identifier string) error {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+	return APIstub.DelPrivateData(mainInfoCollection, key)
+}
+
+//식별자의 공개 원장 이력을 오래된 순서로 모두 가져오는 함수
+//migrateMainInfoKeys로 옮긴 정보는 예전 키(식별자 그대로)의 이력이 먼저 나온다.
+func getMainInfoKeyModifications(APIstub shim.ChaincodeStubInterface, identifier string) ([]*queryresult.KeyModification, error) {
+	key, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	modifications := []*queryresult.KeyModification{}
+	for _, historyKey := range []string{identifier, key} {
+		resultsIterator, err := APIstub.GetHistoryForKey(historyKey)
+		if err != nil {
+			return nil, err
+		}
+		for resultsIterator.HasNext() {
+			response, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+			modifications = append(modifications, response)
+		}
+		resultsIterator.Close()
+	}
+
+	return modifications, nil
+}
+
+//이력을 훑어서 asOf 시각에 유효했던 정보를 찾는 함수
+func resolveMainInfoAsOf(APIstub shim.ChaincodeStubInterface, identifier string, asOf time.Time) (MainInfoAsOf, error) {
+	mainInfoAsOf := MainInfoAsOf{Identifier: identifier, AsOf: asOf.UTC().Format(time.RFC3339Nano), Status: "notFound"}
+
+	modifications, err := getMainInfoKeyModifications(APIstub, identifier)
+	if err != nil {
+		return mainInfoAsOf, err
+	}
+
+	var latestTime time.Time
+	var latestValue []byte
+	for _, response := range modifications {
+
+		txTime := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC()
+		if txTime.After(asOf) || (mainInfoAsOf.TxId != "" && txTime.Before(latestTime)) {
+			continue
+		}
+
+		latestTime = txTime
+		latestValue = response.Value
+		mainInfoAsOf.TxId = response.TxId
+		mainInfoAsOf.Timestamp = txTime.Format(time.RFC3339Nano)
+		mainInfoAsOf.Status = "found"
+		if response.IsDelete {
+			mainInfoAsOf.Status = "deleted"
+		}
+	}
+
+	if mainInfoAsOf.Status != "found" {
+		return mainInfoAsOf, nil
+	}
+
+	var mainInfo MainInfo
+	err = json.Unmarshal(latestValue, &mainInfo)
+	if err != nil {
+		return mainInfoAsOf, fmt.Errorf("{\"Error\":\"Failed to decode history of: %s\"}", identifier)
+	}
+	mainInfoAsOf.Record = &mainInfo
+
+	revisionKey, err := APIstub.CreateCompositeKey(mainInfoRevisionObjectType, []string{identifier, mainInfoAsOf.TxId})
+	if err != nil {
+		return mainInfoAsOf, err
+	}
+	revisionAsBytes, err := APIstub.GetPrivateData(mainInfoCollection, revisionKey)
+	if err != nil {
+		return mainInfoAsOf, fmt.Errorf("{\"Error\":\"Failed to get private data for %s\"}", identifier)
+	}
+	if revisionAsBytes != nil {
+		var revision MainInfoRevision
+		err = json.Unmarshal(revisionAsBytes, &revision)
+		if err != nil {
+			return mainInfoAsOf, fmt.Errorf("{\"Error\":\"Failed to decode revision of: %s\"}", identifier)
+		}
+		//키를 넣었으면 복호화한다. (diffMainInfo는 키가 없으면 암호문끼리 비교한다)
+		key, err := getMainInfoKeyFromTransient(APIstub, mainInfoKeyTransientKey)
+		if err != nil {
+			return mainInfoAsOf, err
+		}
+		err = openMainInfoForRead(&revision.Info, identifier, key)
+		if err != nil {
+			return mainInfoAsOf, err
+		}
+		mainInfoAsOf.Info = &revision.Info
+	}
+
+	return mainInfoAsOf, nil
+}
+
+//collection에 저장한 블라인드 인덱스 HMAC 키를 가져오는 함수
+func getBlindIndexKey(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	keyKey, err := APIstub.CreateCompositeKey(blindIndexKeyObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := APIstub.GetPrivateData(mainInfoCollection, keyKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get private data: %s", err.Error())
+	} else if key == nil {
+		return nil, fmt.Errorf("{\"Error\":\"blind index key is not set. Call setBlindIndexKey first\"}")
+	}
+
+	return key, nil
+}
+
+//블라인드 인덱스에 넣기 전에 값을 맞추는 함수 (검색할 때와 저장할 때 같은 규칙을 쓴다)
+func normalizeBlindIndexValue(field string, value string) string {
+	return validate.Normalize(field, value)
+}
+
+//validate.Normalize를 쓰기 전에 저장한 블라인드 인덱스의 규칙 (소문자, 앞뒤 공백 제거, 전화번호는 E.164)
+//reindexMainInfo로 다시 저장하기 전까지 예전 인덱스는 이 값으로만 찾을 수 있다.
+func legacyBlindIndexValue(field string, value string) string {
+	if field == "phone" {
+		if phone, ok := validate.NormalizePhone(value); ok {
+			return phone
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+//식별자의 블라인드 인덱스를 지금 값에 맞게 바꾸고, 필드별 인덱스 값을 돌려주는 함수
+func putBlindIndexes(APIstub shim.ChaincodeStubInterface, identifier string, mainInfoPrivate MainInfoPrivate) (map[string]string, error) {
+	key, err := getBlindIndexKey(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	//예전 인덱스는 collection에 저장해 둔 값으로 찾는다. (암호화한 정보도 키 없이 지울 수 있다)
+	previous := MainInfoPrivate{}
+	previousAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get private data: %s", err.Error())
+	}
+	if previousAsBytes != nil {
+		json.Unmarshal(previousAsBytes, &previous)
+	}
+
+	values := map[string]string{"name": mainInfoPrivate.Name, "phone": mainInfoPrivate.Phone, "id": mainInfoPrivate.Id}
+	blindIndexes := map[string]string{}
+	for _, field := range blindIndexFields {
+		value := normalizeBlindIndexValue(field, values[field])
+		blindIndex := ""
+		//지운 필드는 인덱스를 만들지 않는다.
+		if value != "" {
+			blindIndex = fieldcrypt.BlindIndex(key, field, value)
+			blindIndexes[field] = blindIndex
+		}
+
+		previousIndex, ok := previous.BlindIndexes[field]
+		if ok && previousIndex == blindIndex {
+			continue
+		}
+		if ok {
+			err = delBlindIndex(APIstub, field, previousIndex, identifier)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if blindIndex == "" {
+			continue
+		}
+
+		indexKey, err := APIstub.CreateCompositeKey(field, []string{blindIndex, identifier})
+		if err != nil {
+			return nil, err
+		}
+		//marbles 예제처럼 키만 쓰고 값은 비워 둔다.
+		err = APIstub.PutState(indexKey, []byte{0x00})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to put state: %s", err.Error())
+		}
+	}
+
+	return blindIndexes, nil
+}
+
+//식별자의 블라인드 인덱스를 모두 지우는 함수
+func deleteBlindIndexes(APIstub shim.ChaincodeStubInterface, identifier string) error {
+	privateAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return fmt.Errorf("Failed to get private data: %s", err.Error())
+	} else if privateAsBytes == nil {
+		return nil
+	}
+
+	mainInfoPrivate := MainInfoPrivate{}
+	json.Unmarshal(privateAsBytes, &mainInfoPrivate)
+
+	for _, field := range blindIndexFields {
+		blindIndex, ok := mainInfoPrivate.BlindIndexes[field]
+		if !ok {
+			continue
+		}
+		err = delBlindIndex(APIstub, field, blindIndex, identifier)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func delBlindIndex(APIstub shim.ChaincodeStubInterface, field string, blindIndex string, identifier string) error {
+	indexKey, err := APIstub.CreateCompositeKey(field, []string{blindIndex, identifier})
+	if err != nil {
+		return err
+	}
+	err = APIstub.DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("Failed to delete state: %s", err.Error())
+	}
+	return nil
+}
+
+//블라인드 인덱스로 찾은 식별자 중 목적에 동의한 식별자를 돌려주는 함수
+func findMainInfoIdentifiersByBlindIndex(APIstub shim.ChaincodeStubInterface, field string, value string, purpose string) ([]string, error) {
+	key, err := getBlindIndexKey(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	//지금 규칙과 예전 규칙의 값이 다르면 예전 규칙으로 저장된 인덱스도 찾는다.
+	values := []string{normalizeBlindIndexValue(field, value)}
+	if legacyValue := legacyBlindIndexValue(field, value); legacyValue != values[0] {
+		values = append(values, legacyValue)
+	}
+
+	identifiers := []string{}
+	seen := map[string]bool{}
+	for _, indexValue := range values {
+		found, err := getIdentifiersByBlindIndex(APIstub, field, fieldcrypt.BlindIndex(key, field, indexValue))
+		if err != nil {
+			return nil, err
+		}
+		for _, identifier := range found {
+			if !seen[identifier] {
+				seen[identifier] = true
+				identifiers = append(identifiers, identifier)
+			}
+		}
+	}
+
+	include := consentFilter(APIstub, purpose)
+	consented := []string{}
+	for _, identifier := range identifiers {
+		ok, err := include(identifier)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			consented = append(consented, identifier)
+		}
+	}
+
+	return consented, nil
+}
+
+//블라인드 인덱스 값 하나에 걸린 식별자를 가져오는 함수
+func getIdentifiersByBlindIndex(APIstub shim.ChaincodeStubInterface, field string, blindIndex string) ([]string, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(field, []string{blindIndex})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	identifiers := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, keyParts[1])
+	}
+
+	return identifiers, nil
+}
+
+//목적에 동의한 정보를 collection에서 가져오는 함수 (없으면 nil)
+//transient map에 키를 넣었으면 복호화해서, 아니면 암호문 그대로 돌려준다.
+func readMainInfoPrivate(APIstub shim.ChaincodeStubInterface, identifier string, purpose string) ([]byte, error) {
+	err := checkConsent(APIstub, identifier, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	mainInfoAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"Failed to get private data for %s\"}", identifier)
+	}
+
+	key, err := getMainInfoKeyFromTransient(APIstub, mainInfoKeyTransientKey)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || mainInfoAsBytes == nil {
+		return mainInfoAsBytes, nil
+	}
+
+	var mainInfoPrivate MainInfoPrivate
+	err = json.Unmarshal(mainInfoAsBytes, &mainInfoPrivate)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"Failed to decode JSON of: %s\"}", identifier)
+	}
+	err = openMainInfoPrivate(&mainInfoPrivate, identifier, key)
+	if err != nil {
+		return nil, err
+	}
+
+	mainInfoAsBytes, _ = json.Marshal(mainInfoPrivate)
+	return mainInfoAsBytes, nil
+}
+
+//열람 기록을 남기는 함수 (키에 시각을 넣어서 오래된 순서로 읽히게 한다)
+func putMainInfoAccessLog(APIstub shim.ChaincodeStubInterface, identifier string, purpose string, function string, queryField string) error {
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return err
+	}
+
+	accessorMSP, accessorSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	accessorRole, _, err := cid.GetAttributeValue(APIstub, roleAttribute)
+	if err != nil {
+		return fmt.Errorf("Failed to get role attribute: %s", err.Error())
+	}
+
+	entry := MainInfoAccessLogEntry{
+		Identifier: identifier,
+		AccessorMSP: accessorMSP,
+		AccessorSubject: accessorSubject,
+		AccessorRole: accessorRole,
+		Purpose: purpose,
+		Function: function,
+		QueryField: queryField,
+		Timestamp: txTime.Format(time.RFC3339Nano),
+		TxId: APIstub.GetTxID(),
+	}
+
+	//RFC3339Nano는 끝자리 0을 빼서 길이가 달라지므로 키에는 자릿수를 고정한 시각을 쓴다.
+	entryKey, err := APIstub.CreateCompositeKey(mainInfoAccessLogObjectType, []string{identifier, txTime.Format("2006-01-02T15:04:05.000000000Z"), entry.TxId})
+	if err != nil {
+		return err
+	}
+
+	entryAsBytes, _ := json.Marshal(entry)
+	err = APIstub.PutState(entryKey, entryAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put state: %s", err.Error())
+	}
+
+	return nil
+}
+
+//쿼리로 찾은 정보 중 이용 목적에 동의한 정보의 식별자를 돌려주는 함수
+//rich query는 commit할 때 다시 검증되지 않으므로 읽을 때 getMainInfoByAccessGrant가 동의와 정보를 다시 확인한다.
+func findMainInfoIdentifiersByQuery(APIstub shim.ChaincodeStubInterface, queryString string, purpose string) ([]string, error) {
+	resultsIterator, err := APIstub.GetPrivateDataQueryResult(mainInfoCollection, queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	include := consentFilter(APIstub, purpose)
+	identifiers := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		identifier, err := identifierFromKey(APIstub, queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := include(identifier)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+
+	return identifiers, nil
+}
+
+//찾은 정보마다 열람 기록을 남기고 열람 허락 기록을 저장하는 함수
+func grantMainInfoAccess(APIstub shim.ChaincodeStubInterface, identifiers []string, purpose string, function string, queryField string) (MainInfoAccessGrant, error) {
+	for _, identifier := range identifiers {
+		err := putMainInfoAccessLog(APIstub, identifier, purpose, function, queryField)
+		if err != nil {
+			return MainInfoAccessGrant{}, err
+		}
+	}
+
+	return putMainInfoAccessGrant(APIstub, identifiers, purpose, function)
+}
+
+//열람 허락 기록을 남기는 함수 (getMainInfoByAccessGrant에서 트랜잭션 ID로 찾는다)
+func putMainInfoAccessGrant(APIstub shim.ChaincodeStubInterface, identifiers []string, purpose string, function string) (MainInfoAccessGrant, error) {
+	var grant MainInfoAccessGrant
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return grant, err
+	}
+
+	accessorMSP, accessorSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return grant, err
+	}
+
+	grant = MainInfoAccessGrant{
+		TxId: APIstub.GetTxID(),
+		Identifiers: identifiers,
+		Purpose: purpose,
+		Function: function,
+		AccessorMSP: accessorMSP,
+		AccessorSubject: accessorSubject,
+		Timestamp: txTime.Format(time.RFC3339Nano),
+	}
+
+	grantKey, err := APIstub.CreateCompositeKey(mainInfoAccessGrantObjectType, []string{grant.TxId})
+	if err != nil {
+		return grant, err
+	}
+
+	grantAsBytes, _ := json.Marshal(grant)
+	err = APIstub.PutState(grantKey, grantAsBytes)
+	if err != nil {
+		return grant, fmt.Errorf("Failed to put state: %s", err.Error())
+	}
+
+	return grant, nil
+}
+
+//식별자의 열람 기록을 모두 가져오는 함수
+func getMainInfoAccessLog(APIstub shim.ChaincodeStubInterface, identifier string) ([]MainInfoAccessLogEntry, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(mainInfoAccessLogObjectType, []string{identifier})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	entries := []MainInfoAccessLogEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var entry MainInfoAccessLogEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("{\"Error\":\"Failed to decode access log of: %s\"}", identifier)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+//collection에서 식별자의 현재 값과 사본을 모두 지우는 함수 (지운 키 개수와 그 중 평문이던 키 개수를 돌려준다)
+func purgeMainInfoPrivate(APIstub shim.ChaincodeStubInterface, identifier string) (int, int, error) {
+	resultsIterator, err := APIstub.GetPrivateDataByPartialCompositeKey(mainInfoCollection, mainInfoRevisionObjectType, []string{identifier})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resultsIterator.Close()
+
+	currentKey, err := mainInfoKey(APIstub, identifier)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	currentAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return 0, 0, err
+	}
+	var current MainInfoPrivate
+	if currentAsBytes != nil {
+		json.Unmarshal(currentAsBytes, &current)
+	}
+
+	//iterator를 다 읽은 다음에 지운다.
+	keys := []string{currentKey}
+	plaintextKeys := 0
+	if currentAsBytes != nil && current.KeyFingerprint == "" {
+		plaintextKeys++
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, 0, err
+		}
+		keys = append(keys, queryResponse.Key)
+
+		var revision MainInfoRevision
+		json.Unmarshal(queryResponse.Value, &revision)
+		if revision.Info.KeyFingerprint == "" {
+			plaintextKeys++
+		}
+	}
+
+	for _, key := range keys {
+		err = APIstub.DelPrivateData(mainInfoCollection, key)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Failed to delete private data : %s", err.Error())
+		}
+	}
+
+	return len(keys), plaintextKeys, nil
+}
+
+//정보를 공개 원장과 collection에서 지우는 함수 (시점 조회용 사본은 남는다)
+func deleteMainInfoRecord(APIstub shim.ChaincodeStubInterface, identifier string, mainInfo MainInfo) error {
+	err := delMainInfoState(APIstub, identifier)
+	if err != nil {
+		return fmt.Errorf("Failed to delete state : %s", err.Error())
+	}
+
+	err = delRetainUntilIndex(APIstub, identifier, mainInfo.RetainUntil)
+	if err != nil {
+		return err
+	}
+
+	err = deleteBlindIndexes(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+
+	err = delMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return fmt.Errorf("Failed to delete private data : %s", err.Error())
+	}
+
+	return nil
+}
+
+//보유 기한 인덱스 키를 만드는 함수
+func retainUntilIndexKey(APIstub shim.ChaincodeStubInterface, identifier string, retainUntil string) (string, error) {
+	return APIstub.CreateCompositeKey(mainInfoRetainUntilObjectType, []string{retainUntil, identifier})
+}
+
+//보유 기한이 있으면 인덱스를 저장하는 함수
+func putRetainUntilIndex(APIstub shim.ChaincodeStubInterface, identifier string, retainUntil string) error {
+	if retainUntil == "" {
+		return nil
+	}
+	indexKey, err := retainUntilIndexKey(APIstub, identifier, retainUntil)
+	if err != nil {
+		return err
+	}
+	err = APIstub.PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("Failed to put state : %s", err.Error())
+	}
+	return nil
+}
+
+//보유 기한 인덱스를 지우는 함수
+func delRetainUntilIndex(APIstub shim.ChaincodeStubInterface, identifier string, retainUntil string) error {
+	if retainUntil == "" {
+		return nil
+	}
+	indexKey, err := retainUntilIndexKey(APIstub, identifier, retainUntil)
+	if err != nil {
+		return err
+	}
+	err = APIstub.DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("Failed to delete state : %s", err.Error())
+	}
+	return nil
+}
+
+//개인정보와 사본, 인덱스를 모두 지우고 동의를 철회한 뒤 파기 기록을 남기는 함수
+func eraseMainInfoRecord(APIstub shim.ChaincodeStubInterface, identifier string, mainInfo MainInfo, reason string) (MainInfoTombstone, error) {
+	var tombstone MainInfoTombstone
+
+	//지우기 전에 어떤 키로 암호화해 둔 정보인지 확인한다.
+	mainInfoPrivateAsBytes, err := getMainInfoPrivateData(APIstub, identifier)
+	if err != nil {
+		return tombstone, fmt.Errorf("Failed to get private data : %s", err.Error())
+	}
+	var mainInfoPrivate MainInfoPrivate
+	if mainInfoPrivateAsBytes != nil {
+		err = json.Unmarshal(mainInfoPrivateAsBytes, &mainInfoPrivate)
+		if err != nil {
+			return tombstone, fmt.Errorf("{\"Error\":\"Failed to decode private data of: %s\"}", identifier)
+		}
+	}
+
+	err = deleteBlindIndexes(APIstub, identifier)
+	if err != nil {
+		return tombstone, err
+	}
+
+	purgedKeys, plaintextKeys, err := purgeMainInfoPrivate(APIstub, identifier)
+	if err != nil {
+		return tombstone, err
+	}
+
+	//파기한 뒤에는 어떤 목적으로도 쓸 수 없도록 남은 동의를 철회한다.
+	err = withdrawAllConsents(APIstub, identifier)
+	if err != nil {
+		return tombstone, err
+	}
+
+	err = delMainInfoState(APIstub, identifier)
+	if err != nil {
+		return tombstone, fmt.Errorf("Failed to delete state : %s", err.Error())
+	}
+
+	err = delRetainUntilIndex(APIstub, identifier, mainInfo.RetainUntil)
+	if err != nil {
+		return tombstone, err
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return tombstone, err
+	}
+
+	erasedByMSP, erasedBySubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return tombstone, err
+	}
+
+	tombstone = MainInfoTombstone{
+		Identifier: identifier,
+		LastHash: mainInfo.Hash,
+		Reason: reason,
+		PurgedKeys: purgedKeys,
+		KeyFingerprint: mainInfoPrivate.KeyFingerprint,
+		PlaintextKeys: plaintextKeys,
+		ErasedAt: txTime.Format(time.RFC3339Nano),
+		ErasedByMSP: erasedByMSP,
+		ErasedBySubject: erasedBySubject,
+		TxId: APIstub.GetTxID(),
+	}
 
+	tombstoneKey, err := APIstub.CreateCompositeKey(mainInfoTombstoneObjectType, []string{identifier})
+	if err != nil {
+		return tombstone, err
+	}
+	tombstoneAsBytes, _ := json.Marshal(tombstone)
+	err = APIstub.PutState(tombstoneKey, tombstoneAsBytes)
+	if err != nil {
+		return tombstone, fmt.Errorf("Failed to put state : %s", err.Error())
 	}
-	
-	buffer.WriteString("]")
 
-	return &buffer, nil
+	return tombstone, nil
+}
+
+//식별자의 공개 원장 이력을 가져오는 함수 (from, to가 zero면 제한 없음, maxEntries가 0이면 전부)
+func getMainInfoHistory(APIstub shim.ChaincodeStubInterface, identifier string, from time.Time, to time.Time, maxEntries int) ([]MainInfoHistoryEntry, error) {
+	modifications, err := getMainInfoKeyModifications(APIstub, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []MainInfoHistoryEntry{}
+	for _, response := range modifications {
+		if maxEntries > 0 && len(history) >= maxEntries {
+			break
+		}
+
+		txTime := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC()
+		if !from.IsZero() && txTime.Before(from) {
+			continue
+		}
+		if !to.IsZero() && txTime.After(to) {
+			continue
+		}
+
+		entry := MainInfoHistoryEntry{
+			TxId: response.TxId,
+			Timestamp: txTime.Format(time.RFC3339Nano),
+			IsDelete: response.IsDelete,
+		}
+		if !response.IsDelete {
+			var mainInfo MainInfo
+			err = json.Unmarshal(response.Value, &mainInfo)
+			if err != nil {
+				return nil, fmt.Errorf("{\"Error\":\"Failed to decode history of: %s\"}", identifier)
+			}
+			entry.Value = &mainInfo
+			entry.SubmitterMSP = mainInfo.ModifiedByMSP
+			entry.SubmitterSubject = mainInfo.ModifiedBySubject
+		}
+
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+//식별자의 시점 조회용 사본을 모두 가져오는 함수 (키가 맞는 사본은 복호화한다)
+func getMainInfoRevisions(APIstub shim.ChaincodeStubInterface, identifier string, key []byte) ([]MainInfoRevision, error) {
+	resultsIterator, err := APIstub.GetPrivateDataByPartialCompositeKey(mainInfoCollection, mainInfoRevisionObjectType, []string{identifier})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	revisions := []MainInfoRevision{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var revision MainInfoRevision
+		err = json.Unmarshal(queryResponse.Value, &revision)
+		if err != nil {
+			return nil, fmt.Errorf("{\"Error\":\"Failed to decode revision of: %s\"}", identifier)
+		}
+		err = exportMainInfoPrivate(&revision.Info, identifier, key)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+//내보낼 개인정보를 정리하는 함수 (복호화하고, 검색용으로 만든 값은 뺀다)
+func exportMainInfoPrivate(mainInfoPrivate *MainInfoPrivate, identifier string, key []byte) error {
+	err := openMainInfoForRead(mainInfoPrivate, identifier, key)
+	if err != nil {
+		return err
+	}
+	mainInfoPrivate.Normalized = nil
+	mainInfoPrivate.BlindIndexes = nil
+	return nil
+}
+
+//식별자의 동의를 철회한 것까지 모두 가져오는 함수
+func getConsents(APIstub shim.ChaincodeStubInterface, identifier string) ([]Consent, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(consentObjectType, []string{identifier})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	consents := []Consent{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var consent Consent
+		err = json.Unmarshal(queryResponse.Value, &consent)
+		if err != nil {
+			return nil, fmt.Errorf("{\"Error\":\"Failed to decode consent of: %s\"}", identifier)
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, nil
+}
+
+//식별자의 파기 기록을 가져오는 함수 (없으면 nil)
+func getMainInfoTombstone(APIstub shim.ChaincodeStubInterface, identifier string) (*MainInfoTombstone, error) {
+	tombstoneKey, err := APIstub.CreateCompositeKey(mainInfoTombstoneObjectType, []string{identifier})
+	if err != nil {
+		return nil, err
+	}
+
+	tombstoneAsBytes, err := APIstub.GetState(tombstoneKey)
+	if err != nil {
+		return nil, err
+	} else if tombstoneAsBytes == nil {
+		return nil, nil
+	}
+
+	var tombstone MainInfoTombstone
+	err = json.Unmarshal(tombstoneAsBytes, &tombstone)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"Failed to decode tombstone of: %s\"}", identifier)
+	}
+
+	return &tombstone, nil
+}
+
+//식별자의 철회하지 않은 동의를 모두 철회하는 함수
+func withdrawAllConsents(APIstub shim.ChaincodeStubInterface, identifier string) error {
+	consents, err := getConsents(APIstub, identifier)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return err
+	}
+
+	recordedByMSP, recordedBySubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	for _, consent := range consents {
+		if consent.WithdrawnAt != "" {
+			continue
+		}
+		consent.WithdrawnAt = txTime.Format(time.RFC3339Nano)
+		consent.RecordedByMSP = recordedByMSP
+		consent.RecordedBySubject = recordedBySubject
+		err = putConsent(APIstub, consent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//동의를 저장하는 함수
+func putConsent(APIstub shim.ChaincodeStubInterface, consent Consent) error {
+	consentKey, err := APIstub.CreateCompositeKey(consentObjectType, []string{consent.Identifier, consent.Purpose})
+	if err != nil {
+		return err
+	}
+
+	consentAsBytes, _ := json.Marshal(consent)
+	err = APIstub.PutState(consentKey, consentAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put state: %s", err.Error())
+	}
+
+	return nil
+}
+
+//식별자와 목적에 해당하는 동의를 가져오는 함수 (없으면 nil)
+func getConsent(APIstub shim.ChaincodeStubInterface, identifier string, purpose string) (*Consent, error) {
+	consentKey, err := APIstub.CreateCompositeKey(consentObjectType, []string{identifier, purpose})
+	if err != nil {
+		return nil, err
+	}
+
+	consentAsBytes, err := APIstub.GetState(consentKey)
+	if err != nil {
+		return nil, err
+	} else if consentAsBytes == nil {
+		return nil, nil
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentAsBytes, &consent)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"Failed to decode consent of: %s\"}", identifier)
+	}
+
+	return &consent, nil
+}
+
+//정보 주체가 이 목적으로 정보를 쓰는 데 동의했는지 확인하는 함수
+func checkConsent(APIstub shim.ChaincodeStubInterface, identifier string, purpose string) error {
+	consented, err := hasConsent(APIstub, identifier, purpose)
+	if err != nil {
+		return err
+	} else if !consented {
+		return fmt.Errorf("{\"Error\":\"No valid consent for purpose %s: %s\"}", purpose, identifier)
+	}
+	return nil
+}
+
+//철회하지 않았고 만료되지 않은 동의가 있는지 돌려주는 함수
+//정보 주체 본인이 자기 정보를 보는 경우는 동의가 필요 없다.
+func hasConsent(APIstub shim.ChaincodeStubInterface, identifier string, purpose string) (bool, error) {
+	if cid.AssertAttributeValue(APIstub, roleAttribute, subjectRole) == nil {
+		return true, nil
+	}
+
+	consent, err := getConsent(APIstub, identifier, purpose)
+	if err != nil {
+		return false, err
+	} else if consent == nil || consent.WithdrawnAt != "" {
+		return false, nil
+	}
+
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return false, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339, consent.ExpiresAt)
+	if err != nil {
+		return false, nil
+	}
+
+	return txTime.Before(expiresAt), nil
+}
+
+//쿼리 결과 중 목적에 동의한 정보만 남기는 필터
+func consentFilter(APIstub shim.ChaincodeStubInterface, purpose string) func(string) (bool, error) {
+	return func(identifier string) (bool, error) {
+		return hasConsent(APIstub, identifier, purpose)
+	}
+}
+
+//트랜잭션 시각을 UTC로 가져오는 함수
+func getTxTime(APIstub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get transaction timestamp: %s", err.Error())
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+//트랜잭션 제출자의 MSP ID와 인증서 주체를 가져오는 함수
+func getCreatorIdentity(APIstub shim.ChaincodeStubInterface) (string, string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator MSP ID: %s", err.Error())
+	}
+
+	cert, err := cid.GetX509Certificate(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator certificate: %s", err.Error())
+	}
+
+	return mspID, cert.Subject.String(), nil
+}
+
+//호출한 사람의 역할이 함수별 역할표에 있는지 확인하는 함수
+func checkFunctionAccess(APIstub shim.ChaincodeStubInterface, function string, args []string) error {
+	role, _, err := cid.GetAttributeValue(APIstub, roleAttribute)
+	if err != nil {
+		return fmt.Errorf("Failed to get role attribute: %s", err.Error())
+	}
+
+	for _, allowed := range functionRoles[function] {
+		if role != allowed {
+			continue
+		}
+
+		//정보 주체는 자기 식별자에 해당하는 정보만 볼 수 있다.
+		if role == subjectRole {
+			identifier, found, err := cid.GetAttributeValue(APIstub, subjectIdentifierAttribute)
+			if err != nil {
+				return fmt.Errorf("Failed to get identifier attribute: %s", err.Error())
+			}
+			if !found || len(args) == 0 || args[0] != identifier {
+				break
+			}
+		}
+
+		return nil
+	}
+
+	deniedAsBytes, _ := json.Marshal(AccessDenied{Error: "Access denied", Function: function, Role: role})
+	return fmt.Errorf("%s", deniedAsBytes)
+}
+
+//수정하기 전에 읽은 버전이 지금 버전과 같은지 확인하는 함수
+func checkMainInfoVersion(identifier string, mainInfo MainInfo, expectedVersion int64) error {
+	if mainInfo.Version == expectedVersion {
+		return nil
+	}
+
+	conflictAsBytes, _ := json.Marshal(VersionConflict{
+		Error: "Version conflict",
+		Identifier: identifier,
+		ExpectedVersion: expectedVersion,
+		CurrentVersion: mainInfo.Version,
+	})
+	return fmt.Errorf("%s", conflictAsBytes)
+}
+
+//소유자이거나 관리자 속성을 가진 사람인지 확인하는 함수
+func checkMainInfoOwner(APIstub shim.ChaincodeStubInterface, identifier string, mainInfo MainInfo) error {
+	mspID, subject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	if mainInfo.OwnerMSP != "" && mainInfo.OwnerMSP == mspID && mainInfo.OwnerSubject == subject {
+		return nil
+	}
+
+	//소유자가 기록되지 않은 예전 정보는 관리자만 수정할 수 있다.
+	if cid.AssertAttributeValue(APIstub, roleAttribute, adminRole) == nil {
+		return nil
+	}
+
+	return fmt.Errorf("{\"Error\":\"Not authorized to modify: %s\"}", identifier)
+}
+
+//페이지 크기 인자를 검사하는 함수
+func parsePageSize(arg string) (int32, error) {
+	pageSize, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+		return 0, fmt.Errorf("{\"Error\":\"page size must be between 1 and %d\"}", maxPageSize)
+	}
+	return int32(pageSize), nil
+}
+
+//iterator에서 include를 통과한 것을 최대 limit개까지 꺼내는 함수 (include가 nil이면 모두)
+//마지막으로 읽은 키도 같이 돌려준다.
+//Key는 composite key가 아니라 식별자로, lastKey는 다음 페이지를 이어서 찾을 수 있게 원래 키로 돌려준다.
+func collectQueryRecords(APIstub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface, limit int32, include func(string) (bool, error)) ([]QueryRecord, string, error) {
+	records := []QueryRecord{}
+	lastKey := ""
+	for resultsIterator.HasNext() && int32(len(records)) < limit {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		identifier, err := identifierFromKey(APIstub, queryResponse.Key)
+		if err != nil {
+			return nil, "", err
+		}
+		lastKey = queryResponse.Key
+
+		if include != nil {
+			ok, err := include(identifier)
+			if err != nil {
+				return nil, "", err
+			} else if !ok {
+				continue
+			}
+		}
+		records = append(records, QueryRecord{Key: identifier, Record: queryResponse.Value})
+	}
+	return records, lastKey, nil
+}
+
+//MainInfo 쿼리에서 쓸 수 있는 필드
+var mainInfoSchema = selector.NewSchema("name", "phone", "id")
+
+//쿼리를 실제로 보내는 저장된 필드 (toNormalizedCondition으로 옮긴 조건만 쓴다)
+var mainInfoNormalizedSchema = selector.NewSchema("normalized.name", "normalized.phone", "normalized.id")
+
+//클라이언트 조건을 검색용 필드와 값으로 옮기는 함수
+func toNormalizedCondition(condition selector.Condition) selector.Condition {
+	return condition.Map(func(field string, value interface{}) (string, interface{}) {
+		if text, ok := value.(string); ok {
+			value = validate.Normalize(field, text)
+		}
+		return "normalized." + field, value
+	})
+}
+
+//보유 기한을 정하는 함수 (목적과 기한을 돌려준다)
+//기한을 넣었으면 그 기한을 쓰고, 아니면 목적(없으면 default)의 정책으로 지금부터 보유 기간만큼 더한다.
+//목적을 넣지 않았는데 default 정책도 없으면 예전처럼 기한 없이 저장한다.
+//목적이나 기한이 잘못됐으면 batchStatusRejected와 에러를, 원장을 읽지 못하면 빈 상태와 에러를 돌려준다.
+func resolveRetainUntil(APIstub shim.ChaincodeStubInterface, purpose string, retainUntil string) (string, string, string, error) {
+	txTime, err := getTxTime(APIstub)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if retainUntil != "" {
+		deadline, err := time.Parse(time.RFC3339, retainUntil)
+		if err != nil || !deadline.After(txTime) {
+			return "", "", batchStatusRejected, fmt.Errorf("{\"Error\":\"retainUntil must be a future RFC3339 timestamp\"}")
+		}
+		return purpose, deadline.UTC().Format(time.RFC3339), "", nil
+	}
+
+	explicit := purpose != ""
+	if !explicit {
+		purpose = defaultRetentionPurpose
+	}
+
+	//composite key로 만들 수 없는 목적은 항목의 문제이다.
+	_, err = APIstub.CreateCompositeKey(retentionPolicyObjectType, []string{purpose})
+	if err != nil {
+		return "", "", batchStatusRejected, fmt.Errorf("{\"Error\":\"retention purpose is invalid: %s\"}", err.Error())
+	}
+
+	policy, err := getRetentionPolicy(APIstub, purpose)
+	if err != nil {
+		return "", "", "", err
+	} else if policy == nil {
+		if explicit {
+			return "", "", batchStatusRejected, fmt.Errorf("{\"Error\":\"no retention policy for purpose: %s\"}", purpose)
+		}
+		return "", "", "", nil
+	}
+
+	return purpose, txTime.AddDate(0, 0, policy.RetentionDays).Format(time.RFC3339), "", nil
 }
 
-//couchDB에 쿼리 날리고 결과값 받아오는 함수
-func getQueryResultForQueryString (APIstub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
-	//쿼리 날림
-	resultsIterator, err := APIstub.GetQueryResult(queryString)
+//목적의 보유 기간 정책을 가져오는 함수 (없으면 nil)
+func getRetentionPolicy(APIstub shim.ChaincodeStubInterface, purpose string) (*RetentionPolicy, error) {
+	policyKey, err := APIstub.CreateCompositeKey(retentionPolicyObjectType, []string{purpose})
 	if err != nil {
 		return nil, err
 	}
-	//결과값을 json으로 이쁘게 변환
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+
+	policyAsBytes, err := APIstub.GetState(policyKey)
 	if err != nil {
 		return nil, err
+	} else if policyAsBytes == nil {
+		return nil, nil
+	}
+
+	var policy RetentionPolicy
+	err = json.Unmarshal(policyAsBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("{\"Error\":\"Failed to decode retention policy of: %s\"}", purpose)
+	}
+
+	return &policy, nil
+}
+
+//보유 기한 쿼리에서 쓰는 필드 (RFC3339 UTC 초 단위로 저장하므로 문자열 비교가 시각 비교와 같다)
+var retentionSchema = selector.NewSchema("retainUntil")
+
+//asOf까지 보유 기한이 지난 정보를 찾는 쿼리 (META-INF/statedb/couchdb/indexes/indexRetainUntil.json)
+func buildExpiredMainInfoQuery(asOf time.Time) (string, error) {
+	query, err := retentionSchema.Build(selector.Lte("retainUntil", asOf.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return "", err
+	}
+	return query.WithIndex("indexRetainUntilDoc", "indexRetainUntil").String(), nil
+}
+
+//쿼리에 쓰인 필드별로 사용할 인덱스 (META-INF/statedb/couchdb/collections/collectionMainInfoPrivate/indexes)
+var mainInfoIndexes = map[string]string{
+	"name":       "indexName",
+	"phone":      "indexPhone",
+	"id":         "indexId",
+	"name,phone": "indexNamePhone",
+	"id,name":    "indexNameId",
+}
+
+//조건을 검사해서 couchDB 쿼리 문자열로 만드는 함수 (맞는 인덱스가 있으면 use_index를 넣는다)
+//condition은 클라이언트 필드로 받고, 쿼리는 검색용 필드로 만든다.
+func buildMainInfoQuery(condition selector.Condition) (string, error) {
+	query, err := mainInfoNormalizedSchema.Build(toNormalizedCondition(condition))
+	if err != nil {
+		return "", fmt.Errorf("{\"Error\":\"Invalid query: %s\"}", err.Error())
+	}
+
+	indexName, ok := mainInfoIndexes[strings.Join(condition.Fields(), ",")]
+	if ok {
+		query = query.WithIndex(indexName+"Doc", indexName)
+	}
+
+	return query.String(), nil
+}
+
+//iterator를 json으로 이쁘게 변환하기 위한 함수
+func constructQueryResponseFromIterator(APIstub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+
+		identifier, err := identifierFromKey(APIstub, queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.WriteString("{\"Key\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(identifier)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Record\":")
+		buffer.WriteString(string(queryResponse.Value))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+
 	}
+	
+	buffer.WriteString("]")
 
-	return buffer.Bytes(), nil
+	return &buffer, nil
 }
 
 //Iterator size 재는 함수인데 식별자를 키로 쓰면 쓸필요 없음 
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"github.com/fabcar/go/selector"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+type SmartContract struct {
+}
+
+type PersonalInfo struct {
+	Identifier string `json:"identifier"`
+	RegistrationNumber string `json:"registrationNumber"`
+	Address string `json:"address"`
+	Email string `json:"email"`
+	//비밀번호는 원장에 두지 않는다. (예전 정보의 password 필드는 다음 수정 때 빠진다)
+	Logs string `json:"logs"`
+	//정보를 생성한 사람의 MSP ID와 인증서 주체
+	OwnerMSP string `json:"ownerMsp"`
+	OwnerSubject string `json:"ownerSubject"`
+}
+
+//개인정보를 읽거나 지운 기록 하나 (composite key: PersonalInfoAccessLog~식별자~시각~트랜잭션 ID)
+//식별자는 키에만 넣는다. 값에 identifier 필드가 있으면 queryPersonalInfoByQueryString에 기록이 같이 걸린다.
+//정보를 읽는 함수는 모두 기록을 남기므로 query가 아니라 invoke(트랜잭션)로 호출해야 기록이 원장에 남는다.
+type PersonalInfoAccessLogEntry struct {
+	AccessorMSP string `json:"accessorMsp"`
+	AccessorSubject string `json:"accessorSubject"`
+	Reason string `json:"reason"`
+	Function string `json:"function"`
+	//검색해서 읽은 경우 검색한 필드 (값은 남기지 않는다)
+	QueryField string `json:"queryField,omitempty"`
+	Timestamp string `json:"timestamp"`
+	TxId string `json:"txId"`
+}
+
+//열람 기록의 composite key 종류
+const personalInfoAccessLogObjectType = "PersonalInfoAccessLog"
+
+//소유자가 아니어도 수정/삭제할 수 있는 관리자 인증서 속성
+const roleAttribute = "role"
+const adminRole = "admin"
+
+func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response {
+	function, args := APIstub.GetFunctionAndParameters()
+
+	if function == "createPersonalInfo" {
+		//개인정보 생성
+		return s.createPersonalInfo(APIstub, args)
+	} else if function == "getAllPersonalInfo" {
+		//원장의 모든 정보 가져오기
+		return s.getAllPersonalInfo(APIstub, args)
+	} else if function == "getPersonalInfoByIdentifier" {
+		//식별자로 정보 가져오기
+		return s.getPersonalInfoByIdentifier(APIstub, args)
+	} else if function == "queryPersonalInfoByRegistrationNumber" {
+		//주민등록번호로 정보 가져오기
+		return s.queryPersonalInfoByField(APIstub, "registrationNumber", args)
+	} else if function == "queryPersonalInfoByAddress" {
+		//주소로 정보 가져오기
+		return s.queryPersonalInfoByField(APIstub, "address", args)
+	} else if function == "queryPersonalInfoByEmail" {
+		//이메일로 정보 가져오기
+		return s.queryPersonalInfoByField(APIstub, "email", args)
+	} else if function == "queryPersonalInfoByQueryString" {
+		//쿼리로 정보 가져오기
+		return s.queryPersonalInfoByQueryString(APIstub, args)
+	} else if function == "getHistoryPersonalInfo" {
+		//정보 이력 가져오기
+		return s.getHistoryPersonalInfo(APIstub, args)
+	} else if function == "updatePersonalInfo" {
+		//정보 수정하기
+		return s.updatePersonalInfo(APIstub, args)
+	} else if function == "updateLogs" {
+		//로그만 수정하기
+		return s.updateLogs(APIstub, args)
+	} else if function == "deletePersonalInfo" {
+		//정보 삭제하기
+		return s.deletePersonalInfo(APIstub, args)
+	} else if function == "getAccessLogForPersonalInfo" {
+		//열람 기록 가져오기
+		return s.getAccessLogForPersonalInfo(APIstub, args)
+	}
+
+	return shim.Error("Invalid Smart Contract function name. ")
+}
+
+// 개인정보 생성 함수
+// args: 식별자, 주민등록번호, 주소, 이메일, 로그
+func (s *SmartContract) createPersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	if args[0] == "" || args[1] == "" || args[2] == "" || args[3] == "" {
+		return shim.Error("{\"Error\":\"identifier, registrationNumber, address and email must not be empty\"}")
+	}
+
+	//같은 식별자로 등록되어 있는것이 있는지 확인한다.
+	resultsAsBytes, _ := APIstub.GetState(args[0])
+	if resultsAsBytes != nil {
+		return shim.Error("Already exists!!!")
+	}
+
+	//같은 주민등록번호로 등록되어 있는것이 있는지 확인한다.
+	queryResults, err := getQueryResultForField(APIstub, "registrationNumber", args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if string(queryResults) != "[]" {
+		return shim.Error("{\"Error\":\"registrationNumber already exists\"}")
+	}
+
+	//생성한 사람을 소유자로 기록한다.
+	ownerMSP, ownerSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var personalInfo = PersonalInfo{
+		Identifier: args[0],
+		RegistrationNumber: args[1],
+		Address: args[2],
+		Email: args[3],
+		Logs: args[4],
+		OwnerMSP: ownerMSP,
+		OwnerSubject: ownerSubject,
+	}
+	personalInfoAsBytes, _ := json.Marshal(personalInfo)
+	APIstub.PutState(args[0], personalInfoAsBytes)
+
+	return shim.Success(nil)
+}
+
+//모든 정보 가져오는 함수 (읽은 정보마다 열람 기록을 남긴다)
+// args: 로그(조회 사유)
+func (s *SmartContract) getAllPersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	startKey := ""
+	endKey := ""
+
+	resultsIterator, err := APIstub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	//json으로 이쁘게 변환함
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putPersonalInfoAccessLogForResults(APIstub, buffer.Bytes(), args[0], "getAllPersonalInfo", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(buffer.Bytes())
+}
+
+//식별자로 정보 가져오는 함수 (invoke로 호출해야 열람 기록이 원장에 남는다)
+// args: 식별자, 로그(조회 사유)
+func (s *SmartContract) getPersonalInfoByIdentifier(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	personalInfoAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if personalInfoAsBytes == nil {
+		return shim.Error("{\"Error\":\"identifier does not exist: " + args[0] + "\"}")
+	}
+
+	err = putPersonalInfoAccessLog(APIstub, args[0], args[1], "getPersonalInfoByIdentifier", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(personalInfoAsBytes)
+}
+
+//필드 값으로 정보 가져오는 함수 (주민등록번호, 주소, 이메일)
+//찾은 정보마다 열람 기록을 남긴다.
+// args: 값, 로그(조회 사유)
+func (s *SmartContract) queryPersonalInfoByField(APIstub shim.ChaincodeStubInterface, field string, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	queryResults, err := getQueryResultForField(APIstub, field, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putPersonalInfoAccessLogForResults(APIstub, queryResults, args[1], "queryPersonalInfoByField", field)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(queryResults)
+}
+
+//쿼리로 정보 가져오기 (찾은 정보마다 열람 기록을 남긴다)
+// args: 쿼리, 로그(조회 사유)
+func (s *SmartContract) queryPersonalInfoByQueryString(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	//허용한 필드와 연산자만 쓸 수 있도록 검사한 뒤 다시 만든다.
+	condition, err := personalInfoSchema.Parse(args[0])
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid query: " + err.Error() + "\"}")
+	}
+	query, err := personalInfoSchema.Build(condition)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	queryResults, err := getQueryResultForQueryString(APIstub, query.String())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putPersonalInfoAccessLogForResults(APIstub, queryResults, args[1], "queryPersonalInfoByQueryString", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(queryResults)
+}
+
+//식별자에 해당하는 정보의 이력 가져오기 (열람 기록을 남긴다)
+// args: 식별자, 로그(조회 사유)
+func (s *SmartContract) getHistoryPersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of argument. Expecting 2")
+	}
+
+	identifier := args[0]
+
+	resultsIterator, err := APIstub.GetHistoryForKey(identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"TxId\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(response.TxId)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Value\":")
+		if response.IsDelete {
+			buffer.WriteString("null")
+		} else {
+			buffer.WriteString(string(response.Value))
+		}
+
+		buffer.WriteString(", \"Timestamp\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"IsDelete\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(strconv.FormatBool(response.IsDelete))
+		buffer.WriteString("\"")
+
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+	buffer.WriteString("]")
+
+	err = putPersonalInfoAccessLog(APIstub, identifier, args[1], "getHistoryPersonalInfo", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(buffer.Bytes())
+}
+
+//정보 수정을 위한 함수 (빈 값은 수정하지 않는다)
+// args: 식별자, 주민등록번호, 주소, 이메일, (선택) 로그
+func (s *SmartContract) updatePersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
+	}
+
+	personalInfo, err := getPersonalInfoForUpdate(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if args[1] != "" {
+		personalInfo.RegistrationNumber = args[1]
+	}
+
+	if args[2] != "" {
+		personalInfo.Address = args[2]
+	}
+
+	if args[3] != "" {
+		personalInfo.Email = args[3]
+	}
+
+	if len(args) == 5 && args[4] != "" {
+		personalInfo.Logs = args[4]
+	}
+
+	personalInfoAsBytes, _ := json.Marshal(personalInfo)
+	APIstub.PutState(args[0], personalInfoAsBytes)
+
+	return shim.Success(nil)
+}
+
+//로그만 수정하는 함수
+// args: 식별자, 로그
+func (s *SmartContract) updateLogs(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	personalInfo, err := getPersonalInfoForUpdate(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	personalInfo.Logs = args[1]
+
+	personalInfoAsBytes, _ := json.Marshal(personalInfo)
+	APIstub.PutState(args[0], personalInfoAsBytes)
+
+	return shim.Success(nil)
+}
+
+//정보를 삭제하는 함수
+// args: 식별자, 로그(삭제 사유)
+func (s *SmartContract) deletePersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	identifier := args[0]
+
+	_, err := getPersonalInfoForUpdate(APIstub, identifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = APIstub.DelState(identifier)
+	if err != nil {
+		return shim.Error("Failed to delete state : " + err.Error())
+	}
+
+	err = putPersonalInfoAccessLog(APIstub, identifier, args[1], "deletePersonalInfo", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//식별자의 열람 기록을 가져오는 함수 (관리자만)
+// args: 식별자
+func (s *SmartContract) getAccessLogForPersonalInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	if cid.AssertAttributeValue(APIstub, roleAttribute, adminRole) != nil {
+		return shim.Error("{\"Error\":\"Not authorized to read access log of: " + args[0] + "\"}")
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(personalInfoAccessLogObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	entries := []PersonalInfoAccessLogEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var entry PersonalInfoAccessLogEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return shim.Error("{\"Error\":\"Failed to decode access log of: " + args[0] + "\"}")
+		}
+		entries = append(entries, entry)
+	}
+
+	entriesAsBytes, _ := json.Marshal(entries)
+	return shim.Success(entriesAsBytes)
+}
+
+//열람 기록을 남기는 함수 (키에 시각을 넣어서 오래된 순서로 읽히게 한다)
+func putPersonalInfoAccessLog(APIstub shim.ChaincodeStubInterface, identifier string, reason string, function string, queryField string) error {
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("Failed to get transaction timestamp: %s", err.Error())
+	}
+	txTime := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC()
+
+	accessorMSP, accessorSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	entry := PersonalInfoAccessLogEntry{
+		AccessorMSP: accessorMSP,
+		AccessorSubject: accessorSubject,
+		Reason: reason,
+		Function: function,
+		QueryField: queryField,
+		Timestamp: txTime.Format(time.RFC3339Nano),
+		TxId: APIstub.GetTxID(),
+	}
+
+	//RFC3339Nano는 끝자리 0을 빼서 길이가 달라지므로 키에는 자릿수를 고정한 시각을 쓴다.
+	entryKey, err := APIstub.CreateCompositeKey(personalInfoAccessLogObjectType, []string{identifier, txTime.Format("2006-01-02T15:04:05.000000000Z"), entry.TxId})
+	if err != nil {
+		return err
+	}
+
+	entryAsBytes, _ := json.Marshal(entry)
+	err = APIstub.PutState(entryKey, entryAsBytes)
+	if err != nil {
+		return fmt.Errorf("Failed to put state: %s", err.Error())
+	}
+
+	return nil
+}
+
+//조회 결과({"Key":..,"Record":..} 배열)에 담긴 정보마다 열람 기록을 남기는 함수
+func putPersonalInfoAccessLogForResults(APIstub shim.ChaincodeStubInterface, queryResults []byte, reason string, function string, queryField string) error {
+	var records []struct {
+		Key string `json:"Key"`
+	}
+	err := json.Unmarshal(queryResults, &records)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err = putPersonalInfoAccessLog(APIstub, record.Key, reason, function, queryField)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//수정/삭제할 정보를 가져오고 소유자나 관리자인지 확인하는 함수
+func getPersonalInfoForUpdate(APIstub shim.ChaincodeStubInterface, identifier string) (PersonalInfo, error) {
+	var personalInfo PersonalInfo
+
+	personalInfoAsBytes, err := APIstub.GetState(identifier)
+	if err != nil {
+		return personalInfo, fmt.Errorf("{\"Error\":\"Failed to get state for %s\"}", identifier)
+	} else if personalInfoAsBytes == nil {
+		return personalInfo, fmt.Errorf("{\"Error\":\"identifier does not exist: %s\"}", identifier)
+	}
+
+	err = json.Unmarshal(personalInfoAsBytes, &personalInfo)
+	if err != nil {
+		return personalInfo, fmt.Errorf("{\"Error\":\"Failed to decode JSON of: %s\"}", identifier)
+	}
+
+	mspID, subject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return personalInfo, err
+	}
+
+	if personalInfo.OwnerMSP == mspID && personalInfo.OwnerSubject == subject {
+		return personalInfo, nil
+	}
+
+	if cid.AssertAttributeValue(APIstub, roleAttribute, adminRole) == nil {
+		return personalInfo, nil
+	}
+
+	return personalInfo, fmt.Errorf("{\"Error\":\"Not authorized to modify: %s\"}", identifier)
+}
+
+//트랜잭션 제출자의 MSP ID와 인증서 주체를 가져오는 함수
+func getCreatorIdentity(APIstub shim.ChaincodeStubInterface) (string, string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator MSP ID: %s", err.Error())
+	}
+
+	cert, err := cid.GetX509Certificate(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator certificate: %s", err.Error())
+	}
+
+	return mspID, cert.Subject.String(), nil
+}
+
+//PersonalInfo 쿼리에서 쓸 수 있는 필드
+var personalInfoSchema = selector.NewSchema("identifier", "registrationNumber", "address", "email", "logs")
+
+//필드 하나가 값과 같은 정보를 찾는 함수
+func getQueryResultForField(APIstub shim.ChaincodeStubInterface, field string, value string) ([]byte, error) {
+	query, err := selector.NewSchema(field).Build(selector.Eq(field, value))
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryString(APIstub, query.String())
+}
+
+//iterator를 json으로 이쁘게 변환하기 위한 함수
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+
+		buffer.WriteString("{\"Key\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(queryResponse.Key)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Record\":")
+		buffer.WriteString(string(queryResponse.Value))
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+	}
+
+	buffer.WriteString("]")
+
+	return &buffer, nil
+}
+
+//couchDB에 쿼리 날리고 결과값 받아오는 함수
+func getQueryResultForQueryString(APIstub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+	//쿼리 날림
+	resultsIterator, err := APIstub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	//결과값을 json으로 이쁘게 변환
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func main() {
+	err := shim.Start(new(SmartContract))
+	if err != nil {
+		fmt.Printf("Error creating new Smart Contract: %s", err)
+	}
+}
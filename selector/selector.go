@@ -0,0 +1,352 @@
+//CouchDB 쿼리(mango selector)를 문자열 조합 없이 만들기 위한 패키지
+//값은 항상 json으로 인코딩되고, 필드는 Schema에 등록된 것만 쓸 수 있다.
+package selector
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//selector 조건 하나 (필드 조건이거나 $and/$or 묶음)
+type Condition struct {
+	field string
+	operator string
+	value interface{}
+	children []Condition
+}
+
+//필드 값이 같은지 비교
+func Eq(field string, value interface{}) Condition {
+	return Condition{field: field, operator: "$eq", value: value}
+}
+
+//필드 값이 목록 중 하나인지 비교
+func In(field string, values ...interface{}) Condition {
+	return Condition{field: field, operator: "$in", value: values}
+}
+
+func Gt(field string, value interface{}) Condition {
+	return Condition{field: field, operator: "$gt", value: value}
+}
+
+func Gte(field string, value interface{}) Condition {
+	return Condition{field: field, operator: "$gte", value: value}
+}
+
+func Lt(field string, value interface{}) Condition {
+	return Condition{field: field, operator: "$lt", value: value}
+}
+
+func Lte(field string, value interface{}) Condition {
+	return Condition{field: field, operator: "$lte", value: value}
+}
+
+//필드 값이 literal로 시작하는지 비교 (정규식 특수문자는 이스케이프한다)
+func Prefix(field string, literal string) Condition {
+	return Condition{field: field, operator: "$regex", value: "^" + regexp.QuoteMeta(literal)}
+}
+
+//필드 값에 literal이 들어있는지 비교 (정규식 특수문자는 이스케이프한다)
+func Contains(field string, literal string) Condition {
+	return Condition{field: field, operator: "$regex", value: regexp.QuoteMeta(literal)}
+}
+
+//조건에 쓰인 필드 이름을 정렬해서 돌려주는 함수 (문서 키 필드는 빼고, $or이 있으면 nil)
+//인덱스를 고를 때 사용한다.
+func (c Condition) Fields() []string {
+	seen := map[string]bool{}
+	if !c.collectFields(seen) {
+		return nil
+	}
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (c Condition) collectFields(seen map[string]bool) bool {
+	if c.operator == "$or" {
+		return false
+	}
+	if c.operator == "$and" {
+		for _, child := range c.children {
+			if !child.collectFields(seen) {
+				return false
+			}
+		}
+		return true
+	}
+	if c.field != keyField {
+		seen[c.field] = true
+	}
+	return true
+}
+
+//조건의 필드 이름과 값을 바꾼 조건을 돌려주는 함수 (문서 키 조건은 그대로 둔다)
+//$in의 값은 하나씩 바꾼다. 클라이언트가 보낸 필드를 저장된 필드로 옮길 때 사용한다.
+func (c Condition) Map(mapper func(field string, value interface{}) (string, interface{})) Condition {
+	if c.operator == "$and" || c.operator == "$or" {
+		children := make([]Condition, 0, len(c.children))
+		for _, child := range c.children {
+			children = append(children, child.Map(mapper))
+		}
+		return Condition{operator: c.operator, children: children}
+	}
+	if c.field == keyField {
+		return c
+	}
+
+	if values, ok := c.value.([]interface{}); ok {
+		field := c.field
+		mapped := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			var mappedValue interface{}
+			field, mappedValue = mapper(c.field, value)
+			mapped = append(mapped, mappedValue)
+		}
+		return Condition{field: field, operator: c.operator, value: mapped}
+	}
+
+	field, value := mapper(c.field, c.value)
+	return Condition{field: field, operator: c.operator, value: value}
+}
+
+//couchDB 문서의 키 필드 (클라이언트 쿼리에서는 쓸 수 없다)
+const keyField = "_id"
+
+//문서 키가 key보다 뒤에 있는지 비교 (키 순서로 페이지를 넘길 때 사용)
+func KeyAfter(key string) Condition {
+	return Condition{field: keyField, operator: "$gt", value: key}
+}
+
+//조건을 모두 만족
+func And(conditions ...Condition) Condition {
+	return Condition{operator: "$and", children: conditions}
+}
+
+//조건 중 하나라도 만족
+func Or(conditions ...Condition) Condition {
+	return Condition{operator: "$or", children: conditions}
+}
+
+//GetQueryResult에 넘길 쿼리
+type Query struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort []map[string]string `json:"sort,omitempty"`
+	UseIndex []string `json:"use_index,omitempty"`
+}
+
+//지정한 인덱스를 쓰도록 한 쿼리를 돌려주는 함수
+func (q Query) WithIndex(designDoc string, indexName string) Query {
+	q.UseIndex = []string{"_design/" + designDoc, indexName}
+	return q
+}
+
+//문서 키 순서로 정렬한 쿼리를 돌려주는 함수
+func (q Query) SortByKey() Query {
+	q.Sort = []map[string]string{{keyField: "asc"}}
+	return q
+}
+
+//쿼리를 json 문자열로 바꾸는 함수
+func (q Query) String() string {
+	queryAsBytes, _ := json.Marshal(q)
+	return string(queryAsBytes)
+}
+
+//selector에서 쓸 수 있는 필드 목록
+type Schema struct {
+	fields map[string]bool
+}
+
+func NewSchema(fields ...string) Schema {
+	schema := Schema{fields: map[string]bool{}}
+	for _, field := range fields {
+		schema.fields[field] = true
+	}
+	return schema
+}
+
+//조건을 검사하고 쿼리로 만드는 함수
+func (s Schema) Build(condition Condition) (Query, error) {
+	built, err := s.build(condition)
+	if err != nil {
+		return Query{}, err
+	}
+	return Query{Selector: built}, nil
+}
+
+func (s Schema) build(condition Condition) (map[string]interface{}, error) {
+	if condition.operator == "$and" || condition.operator == "$or" {
+		if len(condition.children) == 0 {
+			return nil, fmt.Errorf("%s needs at least one condition", condition.operator)
+		}
+		children := make([]interface{}, 0, len(condition.children))
+		for _, child := range condition.children {
+			built, err := s.build(child)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, built)
+		}
+		return map[string]interface{}{condition.operator: children}, nil
+	}
+
+	if !s.fields[condition.field] && condition.field != keyField {
+		return nil, fmt.Errorf("field is not allowed in selector: %s", condition.field)
+	}
+
+	return map[string]interface{}{
+		condition.field: map[string]interface{}{condition.operator: condition.value},
+	}, nil
+}
+
+//클라이언트가 보낸 쿼리에서 허용하는 연산자 ($regex 등은 허용하지 않는다)
+var clientOperators = map[string]bool{
+	"$eq": true,
+	"$in": true,
+	"$gt": true,
+	"$gte": true,
+	"$lt": true,
+	"$lte": true,
+}
+
+//클라이언트가 보낸 {"selector":{...}} 쿼리를 검사해서 조건으로 바꾸는 함수
+//허용하지 않은 필드나 연산자, selector 외의 키가 있으면 에러를 돌려준다.
+func (s Schema) Parse(queryString string) (Condition, error) {
+	var query map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(queryString))
+	decoder.UseNumber()
+	err := decoder.Decode(&query)
+	if err != nil || decoder.More() {
+		return Condition{}, fmt.Errorf("query is not a JSON object")
+	}
+
+	for key := range query {
+		if key != "selector" {
+			return Condition{}, fmt.Errorf("query key is not allowed: %s", key)
+		}
+	}
+
+	selectorObject, ok := query["selector"].(map[string]interface{})
+	if !ok {
+		return Condition{}, fmt.Errorf("query must have a selector object")
+	}
+
+	return s.parseObject(selectorObject)
+}
+
+//selector 객체 하나를 조건으로 바꾸는 함수 (여러 키는 $and로 묶는다)
+func (s Schema) parseObject(object map[string]interface{}) (Condition, error) {
+	var conditions []Condition
+	//endorser마다 같은 쿼리가 나오도록 키 순서를 고정한다.
+	for _, key := range sortedKeys(object) {
+		value := object[key]
+		if key == "$and" || key == "$or" {
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return Condition{}, fmt.Errorf("%s must be a non-empty array", key)
+			}
+			var children []Condition
+			for _, item := range list {
+				itemObject, ok := item.(map[string]interface{})
+				if !ok {
+					return Condition{}, fmt.Errorf("%s items must be objects", key)
+				}
+				child, err := s.parseObject(itemObject)
+				if err != nil {
+					return Condition{}, err
+				}
+				children = append(children, child)
+			}
+			conditions = append(conditions, Condition{operator: key, children: children})
+			continue
+		}
+
+		if strings.HasPrefix(key, "$") {
+			return Condition{}, fmt.Errorf("operator is not allowed: %s", key)
+		}
+		if !s.fields[key] {
+			return Condition{}, fmt.Errorf("field is not allowed in selector: %s", key)
+		}
+
+		fieldConditions, err := parseField(key, value)
+		if err != nil {
+			return Condition{}, err
+		}
+		conditions = append(conditions, fieldConditions...)
+	}
+
+	if len(conditions) == 0 {
+		return Condition{}, fmt.Errorf("selector must not be empty")
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return And(conditions...), nil
+}
+
+//필드 하나의 값 부분을 조건으로 바꾸는 함수
+func parseField(field string, value interface{}) ([]Condition, error) {
+	operators, ok := value.(map[string]interface{})
+	if !ok {
+		if !isScalar(value) {
+			return nil, fmt.Errorf("value of %s must be a string, number or boolean", field)
+		}
+		return []Condition{Eq(field, value)}, nil
+	}
+
+	var conditions []Condition
+	for _, operator := range sortedKeys(operators) {
+		operand := operators[operator]
+		if !clientOperators[operator] {
+			return nil, fmt.Errorf("operator is not allowed: %s", operator)
+		}
+
+		if operator == "$in" {
+			list, ok := operand.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("$in of %s must be a non-empty array", field)
+			}
+			for _, item := range list {
+				if !isScalar(item) {
+					return nil, fmt.Errorf("$in of %s must only hold strings, numbers or booleans", field)
+				}
+			}
+			conditions = append(conditions, In(field, list...))
+			continue
+		}
+
+		if !isScalar(operand) {
+			return nil, fmt.Errorf("%s of %s must be a string, number or boolean", operator, field)
+		}
+		conditions = append(conditions, Condition{field: field, operator: operator, value: operand})
+	}
+
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("value of %s must not be empty", field)
+	}
+	return conditions, nil
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case string, json.Number, bool:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package selector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSchema = NewSchema("name", "phone", "retainUntil")
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		condition Condition
+		want string
+	}{
+		{"Eq", Eq("name", "김수용"), `{"selector":{"name":{"$eq":"김수용"}}}`},
+		{"In", In("phone", "+821011112222", "+821033334444"), `{"selector":{"phone":{"$in":["+821011112222","+821033334444"]}}}`},
+		{"Lte", Lte("retainUntil", "2026-01-01T00:00:00Z"), `{"selector":{"retainUntil":{"$lte":"2026-01-01T00:00:00Z"}}}`},
+		{"Prefix는 정규식을 이스케이프", Prefix("name", "a.b*"), `{"selector":{"name":{"$regex":"^a\\.b\\*"}}}`},
+		{"Contains는 정규식을 이스케이프", Contains("name", "(x)"), `{"selector":{"name":{"$regex":"\\(x\\)"}}}`},
+		{"값의 따옴표는 인코딩", Eq("name", `a"}`), `{"selector":{"name":{"$eq":"a\"}"}}}`},
+		{"KeyAfter는 스키마 없이 허용", And(Eq("name", "a"), KeyAfter("k1")), `{"selector":{"$and":[{"name":{"$eq":"a"}},{"_id":{"$gt":"k1"}}]}}`},
+		{"Or", Or(Eq("name", "a"), Eq("phone", "b")), `{"selector":{"$or":[{"name":{"$eq":"a"}},{"phone":{"$eq":"b"}}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := testSchema.Build(tt.condition)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if query.String() != tt.want {
+				t.Fatalf("Build() = %s, want %s", query.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		condition Condition
+	}{
+		{"등록하지 않은 필드", Eq("password", "x")},
+		{"$and 안의 등록하지 않은 필드", And(Eq("name", "a"), Eq("email", "b"))},
+		{"빈 $and", And()},
+		{"빈 $or", Or()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := testSchema.Build(tt.condition)
+			if err == nil {
+				t.Fatalf("Build() = %s, want error", query.String())
+			}
+		})
+	}
+}
+
+func TestQueryOptions(t *testing.T) {
+	query, err := testSchema.Build(Eq("name", "a"))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	want := `{"selector":{"name":{"$eq":"a"}},"sort":[{"_id":"asc"}],"use_index":["_design/indexNameDoc","indexName"]}`
+	if got := query.SortByKey().WithIndex("indexNameDoc", "indexName").String(); got != want {
+		t.Fatalf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		query string
+		want string
+	}{
+		{"값만 쓰면 $eq", `{"selector":{"name":"a"}}`, `{"selector":{"name":{"$eq":"a"}}}`},
+		{"여러 필드는 키 순서로 $and", `{"selector":{"phone":"b","name":"a"}}`, `{"selector":{"$and":[{"name":{"$eq":"a"}},{"phone":{"$eq":"b"}}]}}`},
+		{"여러 연산자", `{"selector":{"retainUntil":{"$lt":"b","$gte":"a"}}}`, `{"selector":{"$and":[{"retainUntil":{"$gte":"a"}},{"retainUntil":{"$lt":"b"}}]}}`},
+		{"숫자는 그대로", `{"selector":{"name":{"$in":[1,2.5]}}}`, `{"selector":{"name":{"$in":[1,2.5]}}}`},
+		{"$or", `{"selector":{"$or":[{"name":"a"},{"phone":"b"}]}}`, `{"selector":{"$or":[{"name":{"$eq":"a"}},{"phone":{"$eq":"b"}}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, err := testSchema.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			query, err := testSchema.Build(condition)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if query.String() != tt.want {
+				t.Fatalf("Parse() = %s, want %s", query.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		query string
+		message string
+	}{
+		{"json 아님", `{"selector":`, "not a JSON object"},
+		{"뒤에 값이 더 있음", `{"selector":{"name":"a"}} {}`, "not a JSON object"},
+		{"selector 외의 키", `{"selector":{"name":"a"},"use_index":"x"}`, "query key is not allowed"},
+		{"selector 없음", `{}`, "must have a selector"},
+		{"빈 selector", `{"selector":{}}`, "must not be empty"},
+		{"등록하지 않은 필드", `{"selector":{"password":"x"}}`, "field is not allowed"},
+		{"문서 키", `{"selector":{"_id":{"$gt":""}}}`, "field is not allowed"},
+		{"$regex", `{"selector":{"name":{"$regex":".*"}}}`, "operator is not allowed"},
+		{"$ne", `{"selector":{"name":{"$ne":"a"}}}`, "operator is not allowed"},
+		{"최상위 연산자", `{"selector":{"$nor":[{"name":"a"}]}}`, "operator is not allowed"},
+		{"빈 연산자 객체", `{"selector":{"name":{}}}`, "must not be empty"},
+		{"객체 값", `{"selector":{"name":{"$eq":{"a":1}}}}`, "must be a string, number or boolean"},
+		{"null 값", `{"selector":{"name":null}}`, "must be a string, number or boolean"},
+		{"빈 $in", `{"selector":{"name":{"$in":[]}}}`, "non-empty array"},
+		{"$in 안의 객체", `{"selector":{"name":{"$in":[{"a":1}]}}}`, "must only hold"},
+		{"빈 $or", `{"selector":{"$or":[]}}`, "non-empty array"},
+		{"$and 안의 값", `{"selector":{"$and":["a"]}}`, "items must be objects"},
+		{"$or 안의 등록하지 않은 필드", `{"selector":{"$or":[{"name":"a"},{"email":"b"}]}}`, "field is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testSchema.Parse(tt.query)
+			if err == nil {
+				t.Fatalf("Parse() error = nil, want %q", tt.message)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("Parse() error = %v, want %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name string
+		condition Condition
+		want []string
+	}{
+		{"필드 하나", Eq("name", "a"), []string{"name"}},
+		{"$and는 정렬해서 중복 없이", And(Eq("phone", "b"), Eq("name", "a"), Gt("name", "0")), []string{"name", "phone"}},
+		{"문서 키는 뺀다", And(Eq("name", "a"), KeyAfter("k")), []string{"name"}},
+		{"$or가 있으면 nil", And(Eq("name", "a"), Or(Eq("phone", "b"))), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.condition.Fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Fields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	condition := And(Eq("name", "a"), In("phone", "b", "c"), KeyAfter("k"))
+	mapped := condition.Map(func(field string, value interface{}) (string, interface{}) {
+		return "private." + field, strings.ToUpper(value.(string))
+	})
+
+	query, err := NewSchema("private.name", "private.phone").Build(mapped)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	want := `{"selector":{"$and":[{"private.name":{"$eq":"A"}},{"private.phone":{"$in":["B","C"]}},{"_id":{"$gt":"k"}}]}}`
+	if query.String() != want {
+		t.Fatalf("Map() = %s, want %s", query.String(), want)
+	}
+}
@@ -5,13 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	_"strconv"
-	_"time"
+	"strconv"
+	"time"
 	_"reflect"
+	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 
 
+	"github.com/fabcar/go/selector"
+	"github.com/fabcar/go/validate"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
@@ -23,8 +28,52 @@ type MainInfo struct {
 	Name string `json:"name"`
 	Phone string `json:"phone"`
 	Id string `json:"id"`
+	//정보를 생성한 사람의 MSP ID와 인증서 주체
+	OwnerMSP string `json:"ownerMsp"`
+	OwnerSubject string `json:"ownerSubject"`
+	//검색용으로 맞춘 값 (쿼리는 이 값으로 찾는다)
+	Normalized *MainInfoNormalized `json:"normalized,omitempty"`
+	//저장할 때마다 1씩 늘어난다. (버전이 없던 예전 정보는 0)
+	Version int64 `json:"version"`
+	//마지막으로 저장한 트랜잭션 시각 (RFC3339 UTC)
+	UpdatedAt string `json:"updatedAt"`
 }
 
+//수정하려는 버전이 지금 버전과 다를 때 돌려주는 에러
+type VersionConflict struct {
+	Error string `json:"Error"`
+	Identifier string `json:"identifier"`
+	ExpectedVersion int64 `json:"expectedVersion"`
+	CurrentVersion int64 `json:"currentVersion"`
+}
+
+//validate.Normalize로 맞춘 name, phone, id
+type MainInfoNormalized struct {
+	Name string `json:"name"`
+	Phone string `json:"phone"`
+	Id string `json:"id"`
+}
+
+//식별자를 옮긴 뒤 예전 식별자에 남기는 정보
+type MainInfoForward struct {
+	MovedTo string `json:"movedTo"`
+	MigratedAt string `json:"migratedAt"`
+	MigratedByMSP string `json:"migratedByMsp"`
+}
+
+//식별자 버전 (v1은 버전 없이 sha256(name+phone+id)를 쓰던 예전 방식)
+const identifierVersion = "v2"
+
+//식별자를 만들 때 쓰는 채널 비밀 솔트를 넣는 transient map 키
+const identifierSaltTransientKey = "identifierSalt"
+
+//채널 솔트의 지문을 저장하는 composite key 종류 (솔트 자체는 원장에 두지 않는다)
+const identifierSaltObjectType = "IdentifierSaltFingerprint"
+
+//소유자가 아니어도 수정/삭제할 수 있는 관리자 인증서 속성
+const roleAttribute = "role"
+const adminRole = "admin"
+
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
 	return shim.Success(nil)
 }
@@ -50,21 +99,31 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response
 		return s.queryMainInfoById(APIstub, args)
 	} else if function == "queryMainInfoByQueryString" {
 		return s.queryMainInfoByQueryString(APIstub, args)
+	} else if function == "migrateMainInfoIdentifier" {
+		return s.migrateMainInfoIdentifier(APIstub, args)
+	} else if function == "setIdentifierSalt" {
+		return s.setIdentifierSalt(APIstub)
 	}
 
 	return shim.Error("Invalid Smart Contract function name. ")
 }
 
 // 개인정보 생성 함수
+// args: 이름, 연락처, 아이디, transient: identifierSalt = 채널 비밀 솔트
 func (s *SmartContract) createMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	if len(args) != 3 {
 		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
+	salt, err := getIdentifierSalt(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	name := args[0]
 	phone := args[1]
 	id := args[2]
-	identifier := makeIdentifier(&name, &phone, &id)
+	identifier := makeIdentifier(salt, name, phone, id)
 
 	//여기서 identifier 중복 체크
 	valAsByte, _ := APIstub.GetState(identifier)
@@ -72,20 +131,212 @@ func (s *SmartContract) createMainInfo(APIstub shim.ChaincodeStubInterface, args
 		return shim.Error("{\"Error\":\"Already exist!!!\"}")
 	}
 
-	var mainInfo = MainInfo{Name: args[0], Phone: args[1], Id: args[2]}
+	//생성한 사람을 소유자로 기록한다.
+	ownerMSP, ownerSubject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	updatedAt, err := getTxTimeString(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var mainInfo = MainInfo{Name: args[0], Phone: args[1], Id: args[2], OwnerMSP: ownerMSP, OwnerSubject: ownerSubject, Version: 1, UpdatedAt: updatedAt}
+	setNormalized(&mainInfo)
 	mainInfoAsBytes, _ := json.Marshal(mainInfo)
 	APIstub.PutState(identifier, mainInfoAsBytes)
 
 	return shim.Success(nil)
 }
-func makeIdentifier(name *string, phone *string, id *string) string {
-        sha := sha256.New()
-        sha.Write([]byte(*name))
-        sha.Write([]byte(*phone))
-        sha.Write([]byte(*id))
-        identifier := sha.Sum(nil)
-        identifier2 := hex.EncodeToString(identifier)
-        return identifier2
+
+//식별자를 만드는 함수: "v2:" + hex(HMAC-SHA256(솔트, 길이+이름, 길이+연락처, 길이+아이디))
+//값마다 길이를 앞에 붙여서 ("ab","c")와 ("a","bc")가 같아지지 않고,
+//솔트를 모르면 이름과 연락처를 알아도 식별자를 계산할 수 없다.
+//v2 식별자가 바뀌지 않도록 검색용으로 맞춘 값(Normalized)이 아니라 받은 값 그대로 쓴다.
+func makeIdentifier(salt []byte, name string, phone string, id string) string {
+	mac := hmac.New(sha256.New, salt)
+	var length [8]byte
+	for _, field := range []string{name, phone, id} {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		mac.Write(length[:])
+		mac.Write([]byte(field))
+	}
+	return identifierVersion + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//채널 솔트의 지문을 처음 한 번 저장하는 함수 (관리자만)
+//솔트가 바뀌면 같은 사람이 다른 식별자로 등록되므로 덮어쓰지 않는다.
+// transient: identifierSalt = 채널 비밀 솔트
+func (s *SmartContract) setIdentifierSalt(APIstub shim.ChaincodeStubInterface) sc.Response {
+	if cid.AssertAttributeValue(APIstub, roleAttribute, adminRole) != nil {
+		return shim.Error("{\"Error\":\"Not authorized to set identifier salt\"}")
+	}
+
+	saltKey, err := APIstub.CreateCompositeKey(identifierSaltObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, err := APIstub.GetState(saltKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if existing != nil {
+		return shim.Error("{\"Error\":\"identifier salt is already set\"}")
+	}
+
+	salt, err := getTransientIdentifierSalt(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = APIstub.PutState(saltKey, []byte(identifierSaltFingerprint(salt)))
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+//솔트를 구분하기 위한 값 (공개 원장에 남으므로 솔트는 추측할 수 없는 임의의 값이어야 한다)
+func identifierSaltFingerprint(salt []byte) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte("identifier salt fingerprint"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//transient map에서 식별자 솔트를 꺼내서 setIdentifierSalt로 저장한 솔트와 같은지 확인하는 함수
+func getIdentifierSalt(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	salt, err := getTransientIdentifierSalt(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	saltKey, err := APIstub.CreateCompositeKey(identifierSaltObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := APIstub.GetState(saltKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get state: %s", err.Error())
+	} else if fingerprint == nil {
+		return nil, fmt.Errorf("{\"Error\":\"identifier salt is not set. Call setIdentifierSalt first\"}")
+	}
+
+	//다른 솔트로 만든 식별자는 중복 검사와 검색에 걸리지 않으므로 받지 않는다.
+	if !hmac.Equal(fingerprint, []byte(identifierSaltFingerprint(salt))) {
+		return nil, fmt.Errorf("{\"Error\":\"%s does not match the channel identifier salt\"}", identifierSaltTransientKey)
+	}
+
+	return salt, nil
+}
+
+//transient map에서 식별자 솔트를 꺼내는 함수
+func getTransientIdentifierSalt(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+
+	salt, ok := transientMap[identifierSaltTransientKey]
+	if !ok || len(salt) < 16 {
+		return nil, fmt.Errorf("{\"Error\":\"%s must be a key in the transient map with at least 16 bytes\"}", identifierSaltTransientKey)
+	}
+
+	return salt, nil
+}
+
+//예전 방식(v1) 식별자의 정보를 새 식별자로 옮기고, 예전 식별자에는 새 식별자를 남기는 함수
+// args: 예전 식별자, transient: identifierSalt = 채널 비밀 솔트
+func (s *SmartContract) migrateMainInfoIdentifier(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	oldIdentifier := args[0]
+	if strings.HasPrefix(oldIdentifier, identifierVersion+":") {
+		return shim.Error("{\"Error\":\"identifier is already " + identifierVersion + ": " + oldIdentifier + "\"}")
+	}
+
+	mainInfo, forward, err := getMainInfoState(APIstub, oldIdentifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if forward != nil {
+		return shim.Error("{\"Error\":\"identifier was already migrated to: " + forward.MovedTo + "\"}")
+	}
+
+	//소유자나 관리자만 옮길 수 있다.
+	err = checkMainInfoOwner(APIstub, oldIdentifier, *mainInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	salt, err := getIdentifierSalt(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	newIdentifier := makeIdentifier(salt, mainInfo.Name, mainInfo.Phone, mainInfo.Id)
+	valAsBytes, err := APIstub.GetState(newIdentifier)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if valAsBytes != nil {
+		return shim.Error("{\"Error\":\"Already exist: " + newIdentifier + "\"}")
+	}
+
+	setNormalized(mainInfo)
+	mainInfoAsBytes, _ := json.Marshal(mainInfo)
+	err = APIstub.PutState(newIdentifier, mainInfoAsBytes)
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	migratedAt, err := getTxTimeString(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	migratedByMSP, _, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//예전 식별자로 찾는 사람을 위해 개인정보 대신 새 식별자만 남긴다.
+	forwardAsBytes, _ := json.Marshal(MainInfoForward{
+		MovedTo: newIdentifier,
+		MigratedAt: migratedAt,
+		MigratedByMSP: migratedByMSP,
+	})
+	err = APIstub.PutState(oldIdentifier, forwardAsBytes)
+	if err != nil {
+		return shim.Error("Failed to put state : " + err.Error())
+	}
+
+	return shim.Success([]byte(newIdentifier))
+}
+
+//식별자의 정보를 가져오는 함수 (옮긴 식별자면 MainInfoForward를 돌려준다)
+func getMainInfoState(APIstub shim.ChaincodeStubInterface, identifier string) (*MainInfo, *MainInfoForward, error) {
+	valAsBytes, err := APIstub.GetState(identifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("{\"Error\":\"Failed to get state for %s\"}", identifier)
+	} else if valAsBytes == nil {
+		return nil, nil, fmt.Errorf("{\"Error\":\"identifier does not exist: %s\"}", identifier)
+	}
+
+	var forward MainInfoForward
+	err = json.Unmarshal(valAsBytes, &forward)
+	if err == nil && forward.MovedTo != "" {
+		return nil, &forward, nil
+	}
+
+	var mainInfo MainInfo
+	err = json.Unmarshal(valAsBytes, &mainInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("{\"Error\":\"Failed to decode JSON of: %s\"}", identifier)
+	}
+
+	return &mainInfo, nil, nil
 }
 
 func (s *SmartContract) deleteMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
@@ -97,19 +348,19 @@ func (s *SmartContract) deleteMainInfo(APIstub shim.ChaincodeStubInterface, args
 
 	identifier := args[0]
 
-	valAsBytes, err := APIstub.GetState(identifier)
+	mainInfo, forward, err := getMainInfoState(APIstub, identifier)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + identifier + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsBytes == nil {
-		jsonResp = "{\"Error\":\"identifier does not exist: " + identifier + "\"}"
+		return shim.Error(err.Error())
+	} else if forward != nil {
+		jsonResp = "{\"Error\":\"identifier was migrated to: " + forward.MovedTo + "\"}"
 		return shim.Error(jsonResp)
 	}
+	mainInfoJSON = *mainInfo
 
-	err = json.Unmarshal([]byte(valAsBytes), &mainInfoJSON)
+	//소유자나 관리자만 삭제할 수 있다.
+	err = checkMainInfoOwner(APIstub, identifier, mainInfoJSON)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + identifier + "\"}"
-		return shim.Error(jsonResp)
+		return shim.Error(err.Error())
 	}
 
 	err = APIstub.DelState(identifier)
@@ -120,20 +371,42 @@ func (s *SmartContract) deleteMainInfo(APIstub shim.ChaincodeStubInterface, args
 	return shim.Success(nil)
 }
 
+//정보 수정을 위한 함수 (빈 값은 수정하지 않는다)
+// args: 식별자, 이름, 연락처, 아이디, 수정하기 전에 읽은 버전
 func (s *SmartContract) modificateMainInfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	expectedVersion, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil || expectedVersion < 0 {
+		return shim.Error("{\"Error\":\"expected version must be a non-negative number\"}")
+	}
+
+	currentInfo, forward, err := getMainInfoState(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if forward != nil {
+		return shim.Error("{\"Error\":\"identifier was migrated to: " + forward.MovedTo + "\"}")
 	}
+	mainInfo := *currentInfo
 
-	mainInfoAsBytes, err := APIstub.GetState(args[0])
+	//소유자나 관리자만 수정할 수 있다.
+	err = checkMainInfoOwner(APIstub, args[0], mainInfo)
 	if err != nil {
 		return shim.Error(err.Error())
-	} else if mainInfoAsBytes == nil {
-		return shim.Error("Info does not exist")
 	}
 
-	mainInfo := MainInfo{}
-	json.Unmarshal(mainInfoAsBytes, &mainInfo)
+	//다른 사람이 먼저 수정했으면 덮어쓰지 않는다.
+	if mainInfo.Version != expectedVersion {
+		conflictAsBytes, _ := json.Marshal(VersionConflict{
+			Error: "Version conflict",
+			Identifier: args[0],
+			ExpectedVersion: expectedVersion,
+			CurrentVersion: mainInfo.Version,
+		})
+		return shim.Error(string(conflictAsBytes))
+	}
 
 	if args[1] != "" {
 		mainInfo.Name = args[1]
@@ -147,7 +420,14 @@ func (s *SmartContract) modificateMainInfo(APIstub shim.ChaincodeStubInterface,
 		mainInfo.Id = args[3]
 	}
 
-	mainInfoAsBytes, _ = json.Marshal(mainInfo)
+	mainInfo.UpdatedAt, err = getTxTimeString(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mainInfo.Version++
+
+	setNormalized(&mainInfo)
+	mainInfoAsBytes, _ := json.Marshal(mainInfo)
 	APIstub.PutState(args[0], mainInfoAsBytes)
 
 	return shim.Success(nil)
@@ -180,6 +460,12 @@ func (s *SmartContract) getMainInfoByIdentifier(APIstub shim.ChaincodeStubInterf
 
 	mainInfoAsBytes, _ := APIstub.GetState(args[0])
 
+	//옮긴 식별자면 새 식별자의 정보를 돌려준다.
+	var forward MainInfoForward
+	if mainInfoAsBytes != nil && json.Unmarshal(mainInfoAsBytes, &forward) == nil && forward.MovedTo != "" {
+		mainInfoAsBytes, _ = APIstub.GetState(forward.MovedTo)
+	}
+
 	return shim.Success(mainInfoAsBytes)
 }
 
@@ -189,8 +475,10 @@ func (s *SmartContract) queryMainInfoByName(APIstub shim.ChaincodeStubInterface,
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	name := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"name\":\"%s\"}}", name)
+	queryString, err := buildMainInfoQuery(selector.Eq("name", args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	
 	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
 	if err != nil {
@@ -205,8 +493,10 @@ func (s *SmartContract) queryMainInfoByPhone(APIstub shim.ChaincodeStubInterface
 		return shim.Error("Incorrect number of arguments, Excepting 1")
 	}
 
-	phone := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"phone\":\"%s\"}}", phone)
+	queryString, err := buildMainInfoQuery(selector.Eq("phone", args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
 	if err != nil {
@@ -221,8 +511,10 @@ func (s *SmartContract) queryMainInfoById(APIstub shim.ChaincodeStubInterface, a
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	id := strings.ToLower(args[0])
-	queryString := fmt.Sprintf("{\"selector\":{\"id\":\"%s\"}}", id)
+	queryString, err := buildMainInfoQuery(selector.Eq("id", args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
 	if err != nil {
@@ -237,7 +529,15 @@ func (s *SmartContract) queryMainInfoByQueryString(APIstub shim.ChaincodeStubInt
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
-	queryString := strings.ToLower(args[0])
+	//허용한 필드와 연산자만 쓸 수 있도록 검사한 뒤 다시 만든다.
+	condition, err := mainInfoSchema.Parse(args[0])
+	if err != nil {
+		return shim.Error("{\"Error\":\"Invalid query: " + err.Error() + "\"}")
+	}
+	queryString, err := buildMainInfoQuery(condition)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	queryResults, err := getQueryResultForQueryString(APIstub, queryString)
 	if err != nil {
@@ -246,6 +546,98 @@ func (s *SmartContract) queryMainInfoByQueryString(APIstub shim.ChaincodeStubInt
 	return shim.Success(queryResults)
 }
 
+//트랜잭션 시각을 RFC3339 UTC 문자열로 가져오는 함수
+func getTxTimeString(APIstub shim.ChaincodeStubInterface) (string, error) {
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get transaction timestamp: %s", err.Error())
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339Nano), nil
+}
+
+//트랜잭션 제출자의 MSP ID와 인증서 주체를 가져오는 함수
+func getCreatorIdentity(APIstub shim.ChaincodeStubInterface) (string, string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator MSP ID: %s", err.Error())
+	}
+
+	cert, err := cid.GetX509Certificate(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get creator certificate: %s", err.Error())
+	}
+
+	return mspID, cert.Subject.String(), nil
+}
+
+//소유자이거나 관리자 속성을 가진 사람인지 확인하는 함수
+func checkMainInfoOwner(APIstub shim.ChaincodeStubInterface, identifier string, mainInfo MainInfo) error {
+	mspID, subject, err := getCreatorIdentity(APIstub)
+	if err != nil {
+		return err
+	}
+
+	if mainInfo.OwnerMSP != "" && mainInfo.OwnerMSP == mspID && mainInfo.OwnerSubject == subject {
+		return nil
+	}
+
+	//소유자가 기록되지 않은 예전 정보는 관리자만 수정할 수 있다.
+	if cid.AssertAttributeValue(APIstub, roleAttribute, adminRole) == nil {
+		return nil
+	}
+
+	return fmt.Errorf("{\"Error\":\"Not authorized to modify: %s\"}", identifier)
+}
+
+//MainInfo 쿼리에서 쓸 수 있는 필드
+var mainInfoSchema = selector.NewSchema("name", "phone", "id")
+
+//쿼리를 실제로 보내는 저장된 필드
+var mainInfoNormalizedSchema = selector.NewSchema("normalized.name", "normalized.phone", "normalized.id")
+
+//name, phone, id를 검색용으로 맞춘 값을 채우는 함수
+func setNormalized(mainInfo *MainInfo) {
+	mainInfo.Normalized = &MainInfoNormalized{
+		Name: validate.Normalize("name", mainInfo.Name),
+		Phone: validate.Normalize("phone", mainInfo.Phone),
+		Id: validate.Normalize("id", mainInfo.Id),
+	}
+}
+
+//클라이언트 조건을 검색용 필드와 값으로 옮기는 함수
+func toNormalizedCondition(condition selector.Condition) selector.Condition {
+	return condition.Map(func(field string, value interface{}) (string, interface{}) {
+		if text, ok := value.(string); ok {
+			value = validate.Normalize(field, text)
+		}
+		return "normalized." + field, value
+	})
+}
+
+//쿼리에 쓰인 필드별로 사용할 인덱스 (META-INF/statedb/couchdb/indexes)
+var mainInfoIndexes = map[string]string{
+	"name":       "indexName",
+	"phone":      "indexPhone",
+	"id":         "indexId",
+	"name,phone": "indexNamePhone",
+	"id,name":    "indexNameId",
+}
+
+//조건을 검사해서 couchDB 쿼리 문자열로 만드는 함수 (맞는 인덱스가 있으면 use_index를 넣는다)
+//condition은 클라이언트 필드로 받고, 쿼리는 검색용 필드로 만든다.
+func buildMainInfoQuery(condition selector.Condition) (string, error) {
+	query, err := mainInfoNormalizedSchema.Build(toNormalizedCondition(condition))
+	if err != nil {
+		return "", fmt.Errorf("{\"Error\":\"Invalid query: %s\"}", err.Error())
+	}
+
+	indexName, ok := mainInfoIndexes[strings.Join(condition.Fields(), ",")]
+	if ok {
+		query = query.WithIndex(indexName+"Doc", indexName)
+	}
+
+	return query.String(), nil
+}
 
 //iterator를 json으로 이쁘게 변환하기 위한 함수
 func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
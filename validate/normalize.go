@@ -0,0 +1,36 @@
+package validate
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//검색용으로 값을 맞추는 함수 (저장할 때와 검색할 때 같은 규칙을 쓴다)
+//name: NFC, 앞뒤 공백 제거, 공백은 한 칸으로, 대소문자 구분 없음
+//phone: 휴대전화 번호면 E.164, 아니면 숫자만
+//id: NFC, 앞뒤 공백 제거, 대소문자 구분 없음
+func Normalize(field string, value string) string {
+	switch field {
+	case "phone":
+		if phone, ok := NormalizePhone(value); ok {
+			return phone
+		}
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, value)
+	case "name":
+		return foldCase(strings.Join(strings.Fields(norm.NFC.String(value)), " "))
+	}
+	return foldCase(strings.TrimSpace(norm.NFC.String(value)))
+}
+
+//대소문자를 구분하지 않도록 맞추는 함수
+//ſ, K(켈빈 기호)처럼 소문자로만 바꾸면 달라지는 글자도 같게 하려고 대문자를 거쳐 소문자로 바꾼다.
+func foldCase(value string) string {
+	return strings.Map(unicode.ToLower, strings.Map(unicode.ToUpper, value))
+}
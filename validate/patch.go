@@ -0,0 +1,61 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//JSON merge patch(RFC 7396)로 받은 문자열 필드 (값이 nil이면 null, 즉 필드를 지운다)
+type Patch map[string]*string
+
+//merge patch를 읽는 함수
+//fields에 없는 필드와 문자열도 null도 아닌 값은 FieldError로 모아서 돌려준다.
+//null로 지운 필드가 필수 필드인지는 patch를 적용한 뒤의 검사에서 판단한다.
+func DecodePatch(data []byte, fields map[string]bool) (Patch, error) {
+	var rawPatch map[string]json.RawMessage
+	err := json.Unmarshal(data, &rawPatch)
+	if err != nil || rawPatch == nil {
+		return nil, fmt.Errorf("patch must be a JSON object")
+	}
+
+	fieldErrors := Errors{}
+	patch := Patch{}
+	for field, raw := range rawPatch {
+		if !fields[field] {
+			fieldErrors = append(fieldErrors, FieldError{field, "field cannot be patched"})
+			continue
+		}
+		if string(raw) == "null" {
+			patch[field] = nil
+			continue
+		}
+
+		var value string
+		err = json.Unmarshal(raw, &value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{field, "must be a string or null"})
+			continue
+		}
+		patch[field] = &value
+	}
+
+	if len(fieldErrors) > 0 {
+		//endorser마다 같은 에러가 나오도록 필드 순서로 정렬한다.
+		sort.Slice(fieldErrors, func(i, j int) bool { return fieldErrors[i].Field < fieldErrors[j].Field })
+		return nil, fieldErrors
+	}
+
+	return patch, nil
+}
+
+//patch를 적용한 필드 값을 돌려주는 함수 (patch에 없으면 current, null이면 빈 값)
+func (p Patch) Apply(field string, current string) string {
+	value, ok := p[field]
+	if !ok {
+		return current
+	} else if value == nil {
+		return ""
+	}
+	return *value
+}
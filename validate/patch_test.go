@@ -0,0 +1,89 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+var patchFields = map[string]bool{"name": true, "phone": true, "id": true, "salt": true}
+
+func TestDecodePatch(t *testing.T) {
+	tests := []struct {
+		name string
+		input string
+		field string
+		current string
+		want string
+		message string
+	}{
+		{"값 바꾸기", `{"name":"김수용"}`, "name", "한민영", "김수용", ""},
+		{"없는 필드는 그대로", `{"name":"김수용"}`, "phone", "010-1234-5678", "010-1234-5678", ""},
+		{"null은 지우기", `{"phone":null}`, "phone", "010-1234-5678", "", ""},
+		{"빈 문자열", `{"id":""}`, "id", "sooyong01", "", ""},
+		{"바꿀 수 없는 필드", `{"owner":"x"}`, "", "", "", "field cannot be patched"},
+		{"문자열이 아닌 값", `{"name":1}`, "", "", "", "must be a string or null"},
+		{"객체가 아님", `["name"]`, "", "", "", "JSON object"},
+		{"null patch", `null`, "", "", "", "JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := DecodePatch([]byte(tt.input), patchFields)
+			if tt.message != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.message) {
+					t.Fatalf("DecodePatch() error = %v, want %q", err, tt.message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePatch() error = %v", err)
+			}
+			if got := patch.Apply(tt.field, tt.current); got != tt.want {
+				t.Fatalf("Apply(%q) = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePatchErrorOrder(t *testing.T) {
+	_, err := DecodePatch([]byte(`{"phone":1,"owner":"x","id":true}`), patchFields)
+	fieldErrors, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("DecodePatch() error = %v, want Errors", err)
+	}
+	got := []string{}
+	for _, fieldError := range fieldErrors {
+		got = append(got, fieldError.Field)
+	}
+	if strings.Join(got, ",") != "id,owner,phone" {
+		t.Fatalf("fields = %v, want [id owner phone]", got)
+	}
+}
+
+//null로 지운 필수 필드는 patch를 적용한 뒤의 검사에서 거절된다.
+func TestPatchClearRequiredField(t *testing.T) {
+	rules := compileDefault(t)
+	patch, err := DecodePatch([]byte(`{"name":null,"phone":null,"id":null}`), patchFields)
+	if err != nil {
+		t.Fatalf("DecodePatch() error = %v", err)
+	}
+
+	checks := []struct {
+		field string
+		current string
+		check func(string) (string, *FieldError)
+	}{
+		{"name", "김수용", rules.Name},
+		{"phone", "010-1234-5678", rules.Phone},
+		{"id", "sooyong01", rules.Id},
+	}
+	for _, c := range checks {
+		if _, fieldError := c.check(c.current); fieldError != nil {
+			t.Fatalf("%s(%q) error = %v before patch", c.field, c.current, fieldError)
+		}
+		merged := patch.Apply(c.field, c.current)
+		_, fieldError := c.check(merged)
+		if fieldError == nil || fieldError.Field != c.field {
+			t.Fatalf("%s(%q) error = %v, want %s field error", c.field, merged, fieldError, c.field)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+//개인정보 필드(이름, 휴대전화 번호, 아이디)를 검사하는 패키지
+//규칙은 Rules로 바꿀 수 있고, 잘못된 필드는 한 번에 모아서 돌려준다.
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//검사 규칙
+type Rules struct {
+	NameMinLength int `json:"nameMinLength"`
+	NameMaxLength int `json:"nameMaxLength"`
+	//이름에 쓸 수 있는 글자 (정규식)
+	NamePattern string `json:"namePattern"`
+	//아이디 형식 (정규식)
+	IdPattern string `json:"idPattern"`
+	//허용하는 휴대전화 식별번호 (010, 011 ...)
+	MobilePrefixes []string `json:"mobilePrefixes"`
+}
+
+//기본 규칙: 한글/영문 이름 1~50자, 영문으로 시작하는 아이디 4~20자, 010/011/016/017/018/019 번호
+var DefaultRules = Rules{
+	NameMinLength: 1,
+	NameMaxLength: 50,
+	NamePattern: `^[가-힣A-Za-z]+( [가-힣A-Za-z]+)*$`,
+	IdPattern: `^[A-Za-z][A-Za-z0-9_.-]{3,19}$`,
+	MobilePrefixes: []string{"010", "011", "016", "017", "018", "019"},
+}
+
+//정규식을 미리 컴파일해 둔 규칙 (Rules.Compile로 만든다)
+type Compiled struct {
+	Rules
+	namePattern *regexp.Regexp
+	idPattern *regexp.Regexp
+}
+
+//필드 하나의 오류
+type FieldError struct {
+	Field string `json:"field"`
+	Message string `json:"message"`
+}
+
+//필드 오류 목록 (클라이언트에서 필드별로 보여줄 수 있도록 json으로 돌려준다)
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	errorAsBytes, _ := json.Marshal(struct {
+		Error string `json:"Error"`
+		Fields Errors `json:"fields"`
+	}{"validation failed", e})
+	return string(errorAsBytes)
+}
+
+//규칙 자체가 올바른지 확인하는 함수
+func (r Rules) Check() error {
+	_, err := r.Compile()
+	return err
+}
+
+//규칙을 확인하고 정규식을 한 번만 컴파일해 두는 함수 (규칙을 읽어 올 때 부른다)
+func (r Rules) Compile() (*Compiled, error) {
+	if r.NameMinLength < 1 || r.NameMaxLength < r.NameMinLength {
+		return nil, fmt.Errorf("name length range is invalid: %d~%d", r.NameMinLength, r.NameMaxLength)
+	}
+	namePattern, err := regexp.Compile(r.NamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("namePattern is not a valid regular expression")
+	}
+	idPattern, err := regexp.Compile(r.IdPattern)
+	if err != nil {
+		return nil, fmt.Errorf("idPattern is not a valid regular expression")
+	}
+	if len(r.MobilePrefixes) == 0 {
+		return nil, fmt.Errorf("mobilePrefixes must not be empty")
+	}
+	for _, prefix := range r.MobilePrefixes {
+		if !mobilePrefixPattern.MatchString(prefix) {
+			return nil, fmt.Errorf("mobile prefix is invalid: %s", prefix)
+		}
+	}
+	return &Compiled{r, namePattern, idPattern}, nil
+}
+
+//이름을 검사하고 NFC로 맞추고 앞뒤 공백을 뺀 값을 돌려주는 함수
+func (r *Compiled) Name(name string) (string, *FieldError) {
+	//자모로 나뉘어 들어온 한글(NFD)도 음절로 합쳐서 검사한다.
+	name = strings.TrimSpace(norm.NFC.String(name))
+	length := utf8.RuneCountInString(name)
+	if length < r.NameMinLength || length > r.NameMaxLength {
+		return name, &FieldError{"name", fmt.Sprintf("must be %d to %d characters", r.NameMinLength, r.NameMaxLength)}
+	}
+	if !r.namePattern.MatchString(name) {
+		return name, &FieldError{"name", "must only contain Hangul or Latin letters separated by single spaces"}
+	}
+	return name, nil
+}
+
+//휴대전화 번호를 검사하고 E.164(+8210...) 형식으로 돌려주는 함수
+//010-1234-5678, 01012345678, +82 10-1234-5678 등을 받는다.
+func (r Rules) Phone(phone string) (string, *FieldError) {
+	normalized, ok := NormalizePhone(phone)
+	if !ok {
+		return phone, &FieldError{"phone", "must be a Korean mobile number like 010-1234-5678"}
+	}
+
+	prefix := "0" + normalized[3:5]
+	allowed := false
+	for _, mobilePrefix := range r.MobilePrefixes {
+		if mobilePrefix == prefix {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return phone, &FieldError{"phone", "mobile prefix is not allowed: " + prefix}
+	}
+	//010 번호는 가운데 자리가 4자리이다.
+	if prefix == "010" && len(normalized) != len("+821012345678") {
+		return phone, &FieldError{"phone", "010 numbers must have 4 middle digits"}
+	}
+
+	return normalized, nil
+}
+
+//휴대전화 번호 형식이면 E.164로 바꿔서 돌려주는 함수 (식별번호는 확인하지 않는다)
+func NormalizePhone(phone string) (string, bool) {
+	digits := strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(digits, "+82") {
+		digits = "0" + digits[3:]
+	}
+
+	match := mobilePattern.FindStringSubmatch(digits)
+	if match == nil {
+		return phone, false
+	}
+	return "+82" + match[1] + match[2] + match[3], true
+}
+
+//아이디를 검사하는 함수
+func (r *Compiled) Id(id string) (string, *FieldError) {
+	if !r.idPattern.MatchString(id) {
+		return id, &FieldError{"id", "must match " + r.IdPattern}
+	}
+	return id, nil
+}
+
+//0 + 식별번호 두 자리 + 가운데 3~4자리 + 마지막 4자리
+var mobilePattern = regexp.MustCompile(`^0(1[0-9])([0-9]{3,4})([0-9]{4})$`)
+
+var mobilePrefixPattern = regexp.MustCompile(`^01[0-9]$`)
@@ -0,0 +1,190 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+func compileDefault(t *testing.T) *Compiled {
+	compiled, err := DefaultRules.Compile()
+	if err != nil {
+		t.Fatalf("DefaultRules.Compile() error = %v", err)
+	}
+	return compiled
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		change func(r *Rules)
+		message string
+	}{
+		{"기본 규칙", func(r *Rules) {}, ""},
+		{"최소 길이 0", func(r *Rules) { r.NameMinLength = 0 }, "name length range"},
+		{"최대 길이가 최소보다 작음", func(r *Rules) { r.NameMaxLength = 0 }, "name length range"},
+		{"이름 정규식 오류", func(r *Rules) { r.NamePattern = "[" }, "namePattern"},
+		{"아이디 정규식 오류", func(r *Rules) { r.IdPattern = "(" }, "idPattern"},
+		{"식별번호 없음", func(r *Rules) { r.MobilePrefixes = nil }, "mobilePrefixes"},
+		{"식별번호 형식 오류", func(r *Rules) { r.MobilePrefixes = []string{"02"} }, "mobile prefix is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules
+			rules.MobilePrefixes = append([]string(nil), DefaultRules.MobilePrefixes...)
+			tt.change(&rules)
+			err := rules.Check()
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("Check() error = %v, want %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	rules := compileDefault(t)
+	tests := []struct {
+		name string
+		input string
+		want string
+		wantErr bool
+	}{
+		{"한글", "김수용", "김수용", false},
+		{"영문 띄어쓰기", "Sooyong Kim", "Sooyong Kim", false},
+		{"앞뒤 공백", "  김수용 ", "김수용", false},
+		{"NFD 한글은 NFC로", "\u1100\u1175\u11b7", "김", false},
+		{"한 글자", "김", "김", false},
+		{"50자", strings.Repeat("가", 50), strings.Repeat("가", 50), false},
+		{"51자", strings.Repeat("가", 51), "", true},
+		{"빈 값", "", "", true},
+		{"공백만", "   ", "", true},
+		{"숫자", "kim2", "", true},
+		{"연속 공백", "Sooyong  Kim", "", true},
+		{"자모만", "ㄱㄴ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fieldError := rules.Name(tt.input)
+			if (fieldError != nil) != tt.wantErr {
+				t.Fatalf("Name(%q) error = %v, wantErr %v", tt.input, fieldError, tt.wantErr)
+			}
+			if fieldError != nil {
+				if fieldError.Field != "name" {
+					t.Fatalf("Name(%q) error field = %s", tt.input, fieldError.Field)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("Name(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhone(t *testing.T) {
+	rules := compileDefault(t)
+	tests := []struct {
+		name string
+		input string
+		want string
+		wantErr bool
+	}{
+		{"하이픈", "010-1234-5678", "+821012345678", false},
+		{"숫자만", "01012345678", "+821012345678", false},
+		{"국가번호", "+82 10-1234-5678", "+821012345678", false},
+		{"E.164", "+821012345678", "+821012345678", false},
+		{"011 가운데 3자리", "011-123-4567", "+82111234567", false},
+		{"010 가운데 3자리", "010-123-4567", "", true},
+		{"유선 번호", "02-123-4567", "", true},
+		{"허용하지 않은 식별번호", "012-1234-5678", "", true},
+		{"문자", "010-abcd-5678", "", true},
+		{"빈 값", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fieldError := rules.Phone(tt.input)
+			if (fieldError != nil) != tt.wantErr {
+				t.Fatalf("Phone(%q) error = %v, wantErr %v", tt.input, fieldError, tt.wantErr)
+			}
+			if fieldError == nil && got != tt.want {
+				t.Fatalf("Phone(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestId(t *testing.T) {
+	rules := compileDefault(t)
+	tests := []struct {
+		input string
+		wantErr bool
+	}{
+		{"tndyd5390", false},
+		{"abcd", false},
+		{"a_b.c-d", false},
+		{"a" + strings.Repeat("b", 19), false},
+		{"a" + strings.Repeat("b", 20), true},
+		{"abc", true},
+		{"1abcd", true},
+		{"abc d", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, fieldError := rules.Id(tt.input)
+			if (fieldError != nil) != tt.wantErr {
+				t.Fatalf("Id(%q) error = %v, wantErr %v", tt.input, fieldError, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompiledUsesRules(t *testing.T) {
+	rules := DefaultRules
+	rules.IdPattern = `^[0-9]+$`
+	compiled, err := rules.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if _, fieldError := compiled.Id("12345"); fieldError != nil {
+		t.Fatalf("Id() error = %v", fieldError)
+	}
+	if _, fieldError := compiled.Id("abcd"); fieldError == nil {
+		t.Fatalf("Id() accepted a value outside the custom pattern")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	errors := Errors{{"name", "too long"}, {"id", "bad"}}
+	want := `{"Error":"validation failed","fields":[{"field":"name","message":"too long"},{"field":"id","message":"bad"}]}`
+	if errors.Error() != want {
+		t.Fatalf("Error() = %s, want %s", errors.Error(), want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		field string
+		input string
+		want string
+	}{
+		{"name", "  Sooyong   KIM ", "sooyong kim"},
+		{"name", "\u1100\u1175\u11b7", "김"},
+		{"phone", "010-1234-5678", "+821012345678"},
+		{"phone", "02-123-4567", "021234567"},
+		{"id", " TndYd5390 ", "tndyd5390"},
+		{"id", "\u212a", "k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+"/"+tt.input, func(t *testing.T) {
+			if got := Normalize(tt.field, tt.input); got != tt.want {
+				t.Fatalf("Normalize(%q, %q) = %q, want %q", tt.field, tt.input, got, tt.want)
+			}
+		})
+	}
+}